@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CablePair is the cached result of a cable test for one wire pair.
+type CablePair struct {
+	Port      string
+	Pair      string
+	Status    string
+	Length    float64
+	HasLength bool
+}
+
+// cableOKStatuses are the pair statuses that do not indicate a fault.
+var cableOKStatuses = map[string]bool{
+	"ok":       true,
+	"normal":   true,
+	"good":     true,
+	"no fault": true,
+}
+
+func (c *PortStatsCollector) refreshCableDiagnostics(ctx context.Context) {
+	pairs, err := fetchCableDiagnostics(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching cable diagnostics: %v", err)
+		return
+	}
+	for i := range pairs {
+		pairs[i].Port = c.truncateLabel(pairs[i].Port)
+		pairs[i].Pair = c.truncateLabel(pairs[i].Pair)
+		pairs[i].Status = c.truncateLabel(pairs[i].Status)
+	}
+	c.cablePairs = pairs
+}
+
+func (c *PortStatsCollector) collectCableDiagnostics(ch chan<- prometheus.Metric) {
+	seen := map[[2]string]bool{}
+	for _, pair := range c.cablePairs {
+		key := [2]string{pair.Port, pair.Pair}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		role := c.portRole(pair.Port)
+		if pair.HasLength {
+			ch <- c.constMetric(
+				c.portCableLength, prometheus.GaugeValue,
+				pair.Length, pair.Port, role, pair.Pair,
+			)
+		}
+		fault := 0.0
+		if !cableOKStatuses[strings.ToLower(pair.Status)] {
+			fault = 1.0
+		}
+		ch <- c.constMetric(
+			c.portCableFault, prometheus.GaugeValue,
+			fault, pair.Port, role, pair.Pair, pair.Status,
+		)
+	}
+}
+
+func fetchCableDiagnostics(ctx context.Context, config Config) ([]CablePair, error) {
+	doc, err := fetchDocument(ctx, config, config.CableDiagPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseCableDiagnostics(doc), nil
+}
+
+// parseCableDiagnostics reads rows of port, pair, status and length. Rows
+// with only pair, status and length continue the previous port, as the port
+// cell usually spans all pairs.
+func parseCableDiagnostics(doc *goquery.Document) []CablePair {
+	var pairs []CablePair
+	port := ""
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		var cells []string
+		s.Find("td").Each(func(j int, td *goquery.Selection) {
+			cells = append(cells, strings.TrimSpace(td.Text()))
+		})
+
+		switch len(cells) {
+		case 4:
+			port = cells[0]
+			cells = cells[1:]
+		case 3:
+		default:
+			return
+		}
+		if port == "" || cells[0] == "" || cells[1] == "" {
+			return
+		}
+
+		pair := CablePair{Port: port, Pair: cells[0], Status: cells[1]}
+		pair.Length, pair.HasLength = parseNumber(cells[2])
+		pairs = append(pairs, pair)
+	})
+
+	return pairs
+}
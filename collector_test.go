@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newFakeCollector is a collector for config reading from a fakeFetcher
+// that serves testPorts.
+func newFakeCollector(t *testing.T, config Config) (*PortStatsCollector, *fakeFetcher) {
+	t.Helper()
+	collector := NewPortStatsCollector(config, prometheus.NewRegistry())
+	fetcher := &fakeFetcher{stats: testPorts()}
+	collector.SetFetcher(fetcher)
+	return collector, fetcher
+}
+
+func TestCollect(t *testing.T) {
+	collector, fetcher := newFakeCollector(t, testConfig(t, "192.168.1.1", func(c *Config) {
+		c.PortRoles = map[string]string{"Port 1": "uplink"}
+	}))
+
+	expected := `
+# HELP port_state State of the port
+# TYPE port_state gauge
+port_state{port="Port 1",role="uplink"} 1
+port_state{port="Port 2",role="unknown"} 1
+# HELP port_link_status Link status of the port
+# TYPE port_link_status gauge
+port_link_status{port="Port 1",role="uplink"} 1
+port_link_status{port="Port 2",role="unknown"} 0
+# HELP port_tx_good_pkt Number of good packets transmitted on the port
+# TYPE port_tx_good_pkt counter
+port_tx_good_pkt{port="Port 1",role="uplink"} 10
+port_tx_good_pkt{port="Port 2",role="unknown"} 0
+# HELP switch_up Whether the last fetch of the port statistics succeeded
+# TYPE switch_up gauge
+switch_up 1
+`
+	err := testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"port_state", "port_link_status", "port_tx_good_pkt", "switch_up")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// Within the poll rate the fetched statistics are reused
+	testutil.CollectAndCount(collector)
+	if n := fetcher.Calls(); n != 1 {
+		t.Errorf("got %d fetches, want 1", n)
+	}
+}
+
+func TestCollectFetchError(t *testing.T) {
+	collector, fetcher := newFakeCollector(t, testConfig(t, "192.168.1.1", nil))
+	fetcher.Set(PortStatistics{}, errors.New("connection refused"))
+
+	expected := `
+# HELP switch_up Whether the last fetch of the port statistics succeeded
+# TYPE switch_up gauge
+switch_up 0
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "switch_up", "port_state"); err != nil {
+		t.Error(err)
+	}
+	if n := testutil.ToFloat64(collector.scrapeErrorsTotal); n != 1 {
+		t.Errorf("got %v scrape errors, want 1", n)
+	}
+}
+
+func TestCollectTooManyPorts(t *testing.T) {
+	collector, fetcher := newFakeCollector(t, testConfig(t, "192.168.1.1", func(c *Config) {
+		c.MaxPorts = 1
+	}))
+
+	if n := testutil.CollectAndCount(collector, "port_state"); n != 0 {
+		t.Errorf("got %d port_state series from a misparsed page, want 0", n)
+	}
+	fetcher.Set(PortStatistics{Ports: testPorts().Ports[:1]}, nil)
+	collector.Reload(collector.config)
+	if n := testutil.CollectAndCount(collector, "port_state"); n != 1 {
+		t.Errorf("got %d port_state series, want 1", n)
+	}
+}
+
+func TestFetcherKeptAcrossReload(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", nil)
+	collector, fetcher := newFakeCollector(t, config)
+	testutil.CollectAndCount(collector)
+
+	config.PortRoles = map[string]string{"Port 2": "camera"}
+	collector.Reload(config)
+	expected := `
+# HELP port_state State of the port
+# TYPE port_state gauge
+port_state{port="Port 1",role="unknown"} 1
+port_state{port="Port 2",role="camera"} 1
+`
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected), "port_state"); err != nil {
+		t.Error(err)
+	}
+	if n := fetcher.Calls(); n != 2 {
+		t.Errorf("got %d fetches from the fake, want 2", n)
+	}
+}
@@ -0,0 +1,866 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+type Config struct {
+	Address  string `yaml:"address"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	PollRate int    `yaml:"poll_rate_seconds"`
+	Timeout  int    `yaml:"timeout_seconds"`
+	// StatusPollRate is the interval for the slow-changing status pages
+	// (environment, system usage). Port state and link status come from the
+	// stats page and are refreshed with the counters at no extra cost.
+	StatusPollRate int `yaml:"status_poll_rate_seconds"`
+	// FamilyPollRates overrides StatusPollRate per status family, e.g.
+	// cable_diag: 3600.
+	FamilyPollRates map[string]int `yaml:"family_poll_rates_seconds"`
+	// MaxConsecutiveFailures is how many fetches in a row may fail before
+	// the cached port metrics stop being served.
+	MaxConsecutiveFailures int `yaml:"max_consecutive_failures"`
+	// ConnectTimeout bounds only the TCP connect to the switch, so an
+	// unreachable switch fails fast while Timeout still covers the whole
+	// request.
+	ConnectTimeout int `yaml:"connect_timeout_seconds"`
+	// BasePath is prepended to every CGI path, for switches reached
+	// through a reverse proxy under a prefix such as /switch1.
+	BasePath string `yaml:"base_path"`
+	// SmoothingAlpha enables the smoothed byte counters, weighting each
+	// new fetch by alpha (0-1).
+	SmoothingAlpha float64 `yaml:"smoothing_alpha"`
+	// PortAbsentGrace is how long a port that vanished from the statistics
+	// keeps being exported with port_present 0, by default three poll
+	// intervals.
+	PortAbsentGrace int `yaml:"port_absent_grace_seconds"`
+	// LogRepeatInterval is how often an identical fetch error is logged
+	// while the switch keeps failing; repeats in between are counted.
+	LogRepeatInterval int `yaml:"log_repeat_interval_seconds"`
+	// StateFile, if set, keeps the per-port history across restarts.
+	StateFile string `yaml:"state_file"`
+	// MaxPorts rejects fetches yielding more ports, guarding against a
+	// misparse exploding the number of series.
+	MaxPorts int `yaml:"max_ports"`
+	// MaxLabelLength truncates longer port names, guarding against a
+	// misparse turning a chunk of HTML into a label value.
+	MaxLabelLength int `yaml:"max_label_length"`
+	// MaxSwitchRequests bounds the requests running against the switch at
+	// once, however many scrapes overlap. A request waiting longer than
+	// Timeout for its turn fails as busy.
+	MaxSwitchRequests int `yaml:"max_switch_requests"`
+	// SourceAddress is the local IP outgoing switch requests are bound to.
+	SourceAddress string `yaml:"source_address"`
+
+	// SSHHost, if set, makes the exporter reach the switch through an SSH
+	// tunnel to this jump host (host or host:port) instead of directly.
+	// The host key is checked against SSHKnownHostsFile unless
+	// SSHInsecureIgnoreHostKey is set.
+	SSHHost                  string `yaml:"ssh_host"`
+	SSHUser                  string `yaml:"ssh_user"`
+	SSHKeyFile               string `yaml:"ssh_key_file"`
+	SSHKnownHostsFile        string `yaml:"ssh_known_hosts_file"`
+	SSHInsecureIgnoreHostKey bool   `yaml:"ssh_insecure_ignore_host_key"`
+
+	// AuthMode selects how requests to the switch authenticate: "form"
+	// (default) sends the login form and cookie, "bearer" sends APIToken
+	// as a bearer token, for firmware with a REST API.
+	AuthMode string `yaml:"auth_mode"`
+	APIToken string `yaml:"api_token"`
+	// ReauthOnFailure retries a fetch rejected as unauthenticated once,
+	// logging in again, for firmware whose sessions silently expire.
+	ReauthOnFailure bool `yaml:"reauth_on_failure"`
+	// LoginFields renames the fields of the login form by the value they
+	// carry (username, password, language, response), for firmware that
+	// expects e.g. user and pwd. An empty name leaves the field out.
+	LoginFields map[string]string `yaml:"login_fields"`
+	// FormPlacement is where the login form goes: "body" (default), sent
+	// with FormContentType, or "query", appended to the URL with no body.
+	FormPlacement   string `yaml:"form_placement"`
+	FormContentType string `yaml:"form_content_type"`
+	// NumberFormat is how the switch renders counters: "plain" (default),
+	// "comma_grouped" (1,234,567) or "dot_grouped" (1.234.567).
+	NumberFormat string `yaml:"number_format"`
+	// CountersResetOnRead is for stats pages the switch clears every time
+	// they are served: each fetch is added to running totals, which are
+	// exported instead.
+	CountersResetOnRead bool `yaml:"counters_reset_on_read"`
+	// CounterWidthBits is 64 (default), or 32 for switches whose counters
+	// wrap at 2^32; their wraps are then unwrapped into running totals.
+	CounterWidthBits int `yaml:"counter_width_bits"`
+	// RequestHeaders are added to every request to the switch, e.g. a
+	// Referer a WAF in front of it expects. Headers the exporter sets
+	// itself, like Authorization and Cookie, are rejected.
+	RequestHeaders map[string]string `yaml:"request_headers"`
+	// Model selects a built-in layout profile for the stats page. Unset,
+	// the stock layout is used.
+	Model string `yaml:"model"`
+	// RedirectPolicy decides what happens when the switch redirects:
+	// "follow" (default) follows the redirect, "error" fails the request.
+	// Redirects to the login or index page always fail as a rejected login.
+	RedirectPolicy string `yaml:"redirect_policy"`
+	// StatsPath is the page holding the port statistics.
+	StatsPath string `yaml:"stats_path"`
+	// TableSelector is the CSS selector for the rows of the stats table,
+	// for pages with more than one table.
+	TableSelector string `yaml:"table_selector"`
+	// StatsFormat is how the stats page shows the counters: "table"
+	// (default), an HTML table, or "text_table", lines of text in the
+	// elements matching TextSelector, each port read with TextPortPattern
+	// like in telnet mode.
+	StatsFormat     string `yaml:"stats_format"`
+	TextSelector    string `yaml:"text_selector"`
+	TextPortPattern string `yaml:"text_port_pattern"`
+	// SwitchTimeSelector is the CSS selector of the clock on the stats
+	// page, parsed with SwitchTimeLayout (a Go time layout) in local time.
+	SwitchTimeSelector string `yaml:"switch_time_selector"`
+	SwitchTimeLayout   string `yaml:"switch_time_layout"`
+	// SwitchTimestamps exports the port metrics with the switch time as
+	// their timestamp instead of the scrape time, if it was parsed.
+	SwitchTimestamps bool `yaml:"switch_timestamps"`
+
+	// CollectMode selects how port statistics are read: "web" (default)
+	// scrapes the web interface, "snmp" walks the IF-MIB and "telnet" parses
+	// the output of a CLI command.
+	CollectMode   string `yaml:"collect_mode"`
+	SNMPCommunity string `yaml:"snmp_community"`
+	SNMPPort      int    `yaml:"snmp_port"`
+	SNMPVersion   string `yaml:"snmp_version"`
+
+	// Telnet mode logs in to the CLI, runs TelnetCommand and turns every
+	// output line matching TelnetPortPattern into a port. The prompts are
+	// regular expressions matched against the end of the received text.
+	TelnetPort           int    `yaml:"telnet_port"`
+	TelnetUsernamePrompt string `yaml:"telnet_username_prompt"`
+	TelnetPasswordPrompt string `yaml:"telnet_password_prompt"`
+	TelnetPrompt         string `yaml:"telnet_prompt"`
+	TelnetMorePrompt     string `yaml:"telnet_more_prompt"`
+	TelnetCommand        string `yaml:"telnet_command"`
+	TelnetPortPattern    string `yaml:"telnet_port_pattern"`
+
+	// StatsPages replaces the stock stats page for firmware that spreads
+	// the port data over several pages, merged by port name.
+	StatsPages []StatsPage `yaml:"stats_pages"`
+
+	// Labels are constant labels added to every metric of the switch, e.g.
+	// its rack or room.
+	Labels map[string]string `yaml:"labels"`
+
+	// PortRoles assigns a role label (e.g. uplink, access) by port name.
+	// Unlisted ports get the role "unknown".
+	PortRoles map[string]string `yaml:"port_roles"`
+
+	// PortLinkSpeeds sets the link speed in Mbps used for utilization by
+	// port name, for firmware without a port settings page.
+	PortLinkSpeeds map[string]float64 `yaml:"port_link_speeds_mbps"`
+	// SaturationThreshold counts a saturation event for every fetch whose
+	// utilization in either direction exceeds it (0-1, 0 disables).
+	SaturationThreshold float64 `yaml:"saturation_threshold"`
+	// UtilizationEMAAlpha enables the moving average of the utilization,
+	// weighting each new value by it (0-1, 0 disables).
+	UtilizationEMAAlpha float64 `yaml:"utilization_ema_alpha"`
+
+	// Extra port state and link status texts, merged over the defaults.
+	StateValues      map[string]float64 `yaml:"state_values"`
+	LinkStatusValues map[string]float64 `yaml:"link_status_values"`
+	// StateMismatchEnabled exports port_state_mismatch, flagging ports
+	// that are enabled but have no link.
+	StateMismatchEnabled bool `yaml:"state_mismatch_enabled"`
+
+	// Credentials protecting the exporter's own HTTP endpoints.
+	WebUsername string `yaml:"web_username"`
+	WebPassword string `yaml:"web_password"`
+
+	// Timeouts of the exporter's HTTP server, guarding against clients that
+	// hold connections open. Defaults: read 10s, write 30s, idle 60s. The
+	// write timeout must cover a full scrape of the switch.
+	WebReadTimeout  int `yaml:"web_read_timeout_seconds"`
+	WebWriteTimeout int `yaml:"web_write_timeout_seconds"`
+	WebIdleTimeout  int `yaml:"web_idle_timeout_seconds"`
+	// WebMaxRequests caps concurrent /metrics requests, answering 503 to
+	// the rest.
+	WebMaxRequests int `yaml:"web_max_requests_in_flight"`
+	// StartupDelay and a random share of StartupJitter are waited before
+	// the exporter starts serving and polling, so a fleet of exporters
+	// started together does not hit the switches at once.
+	StartupDelay  int `yaml:"startup_delay_seconds"`
+	StartupJitter int `yaml:"startup_jitter_seconds"`
+	// ShutdownTimeout bounds how long in-flight scrapes may delay exit.
+	ShutdownTimeout int `yaml:"shutdown_timeout_seconds"`
+
+	// DiscoveryEnabled probes every host in DiscoveryCIDRs each
+	// DiscoveryInterval and scrapes those serving a stats page along with
+	// the configured switch, using its credentials and settings.
+	DiscoveryEnabled     bool     `yaml:"discovery_enabled"`
+	DiscoveryCIDRs       []string `yaml:"discovery_cidrs"`
+	DiscoveryInterval    int      `yaml:"discovery_interval_seconds"`
+	DiscoveryConcurrency int      `yaml:"discovery_concurrency"`
+
+	// Lightweight fetches only the port statistics, skipping the status
+	// pages of every enabled family, for a switch too slow to serve them.
+	Lightweight bool `yaml:"lightweight"`
+
+	// InfluxEnabled serves the port statistics in the InfluxDB line
+	// protocol on /influx.
+	InfluxEnabled bool `yaml:"influx_enabled"`
+
+	// MetricOverrides changes the name, help or type (counter, gauge,
+	// untyped) of switch metrics by their default name.
+	MetricOverrides map[string]MetricOverride `yaml:"metric_overrides"`
+
+	// MinimalMetrics limits /metrics to the switch metrics, dropping the
+	// exporter self-metrics and the Go runtime collectors.
+	MinimalMetrics bool `yaml:"minimal_metrics"`
+
+	// EnableControl exposes endpoints that change switch state.
+	EnableControl     bool   `yaml:"enable_control"`
+	ClearCountersPath string `yaml:"clear_counters_path"`
+	RebootPath        string `yaml:"reboot_path"`
+	// RebootGrace is how long after a reboot through the exporter failed
+	// fetches are expected and only logged at debug level.
+	RebootGrace int `yaml:"reboot_grace_seconds"`
+
+	// EnableReload exposes POST /-/reload, reloading the configuration
+	// like SIGHUP.
+	EnableReload bool `yaml:"enable_reload"`
+
+	// Model, firmware and hardware version and MAC address from the system
+	// information page, exported as the labels of switch_info.
+	InfoEnabled bool   `yaml:"info_enabled"`
+	InfoPath    string `yaml:"info_path"`
+
+	// Time since the switch booted, from the system information page.
+	UptimeEnabled bool   `yaml:"uptime_enabled"`
+	UptimePath    string `yaml:"uptime_path"`
+
+	// Chassis temperature and fan speed from the system status page.
+	EnvironmentEnabled bool   `yaml:"environment_enabled"`
+	EnvironmentPath    string `yaml:"environment_path"`
+
+	// CPU and memory utilization from the system page. The labels are
+	// matched against the first cell of each row.
+	SystemEnabled bool   `yaml:"system_enabled"`
+	SystemPath    string `yaml:"system_path"`
+	CPULabel      string `yaml:"cpu_label"`
+	MemoryLabel   string `yaml:"memory_label"`
+
+	// Web session slots in use and available, from the session or status
+	// page, to debug logins rejected while the slots are exhausted.
+	SessionsEnabled bool   `yaml:"sessions_enabled"`
+	SessionsPath    string `yaml:"sessions_path"`
+
+	// Configured and negotiated port speeds from the port settings page,
+	// which costs an extra request.
+	PortSpeedEnabled bool   `yaml:"port_speed_enabled"`
+	PortSettingsPath string `yaml:"port_settings_path"`
+
+	// Results of previous cable tests from the cable diagnostics page. Tests
+	// disrupt the link and are only started through the control endpoint.
+	CableDiagEnabled bool   `yaml:"cable_diag_enabled"`
+	CableDiagPath    string `yaml:"cable_diag_path"`
+	CableTestPath    string `yaml:"cable_test_path"`
+
+	// MTU settings, per port or switch-wide depending on the model.
+	MTUEnabled bool   `yaml:"mtu_enabled"`
+	MTUPath    string `yaml:"mtu_path"`
+
+	// Loop prevention and storm control state from the loop status page.
+	LoopStatusEnabled bool   `yaml:"loop_status_enabled"`
+	LoopStatusPath    string `yaml:"loop_status_path"`
+
+	// Oversize, undersize, fragment and jabber frame counters from the
+	// detailed stats page, which only some firmware has.
+	FrameErrorsEnabled bool   `yaml:"frame_errors_enabled"`
+	DetailedStatsPath  string `yaml:"detailed_stats_path"`
+
+	// Per-port VLAN membership from the 802.1Q VLAN page.
+	CollectVLAN bool   `yaml:"collect_vlan"`
+	VLANPath    string `yaml:"vlan_path"`
+
+	// Optional MQTT output, e.g. tcp://broker:1883.
+	MQTTBroker      string `yaml:"mqtt_broker"`
+	MQTTTopicPrefix string `yaml:"mqtt_topic_prefix"`
+	MQTTClientID    string `yaml:"mqtt_client_id"`
+	MQTTUsername    string `yaml:"mqtt_username"`
+	MQTTPassword    string `yaml:"mqtt_password"`
+
+	// Optional webhook receiving a JSON POST when a port goes down or is
+	// disabled, at most once per WebhookMinInterval per port.
+	WebhookURL         string `yaml:"webhook_url"`
+	WebhookMinInterval int    `yaml:"webhook_min_interval_seconds"`
+
+	// Optional Graphite plaintext output, e.g. graphite:2003.
+	GraphiteAddress string `yaml:"graphite_address"`
+	GraphitePrefix  string `yaml:"graphite_prefix"`
+
+	// EnableProbe exposes /probe for the switches in ProbeTargets, given
+	// as hosts or CIDRs. Probes send the switch credentials to the target,
+	// so only listed targets are accepted.
+	EnableProbe  bool     `yaml:"enable_probe"`
+	ProbeTargets []string `yaml:"probe_targets"`
+
+	// Modules are named sets of overrides for /probe, e.g. credentials
+	// and paths shared by one switch family. Each module accepts the same
+	// fields as the top-level config.
+	Modules map[string]yaml.Node `yaml:"modules"`
+}
+
+// normalizeAddress reduces pasted URLs such as "http://10.0.0.1/" to the
+// host and optional port. A path after the host becomes the base path unless
+// one is configured.
+func normalizeAddress(config *Config) {
+	address := strings.TrimSpace(config.Address)
+	if len(address) > len("http://") && strings.EqualFold(address[:len("http://")], "http://") {
+		address = address[len("http://"):]
+	}
+	// Other schemes are left for validateAddress to reject
+	if host, path, ok := strings.Cut(address, "/"); ok && !strings.Contains(address, "://") {
+		address = host
+		if config.BasePath == "" {
+			config.BasePath = path
+		}
+	}
+	config.Address = address
+}
+
+// validateAddress checks that a normalized address is a host with an
+// optional numeric port.
+func validateAddress(address string) error {
+	if address == "" {
+		return nil
+	}
+	if strings.Contains(address, "://") {
+		return fmt.Errorf("%q: only http is supported", address)
+	}
+	u, err := url.Parse("http://" + address)
+	if err != nil {
+		return err
+	}
+	if u.Hostname() == "" || u.User != nil {
+		return fmt.Errorf("%q is not a host", address)
+	}
+	if port := u.Port(); port != "" {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return fmt.Errorf("%q has an invalid port", address)
+		}
+	}
+	return nil
+}
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// reservedLabels are the variable labels of the exported metrics, which
+// constant labels must not shadow.
+var reservedLabels = []string{"port", "role", "direction", "pair", "status", "fan", "switch", "result",
+	"model", "firmware_version", "hardware_version", "mac_address"}
+
+func validateLabels(labels map[string]string) error {
+	for name := range labels {
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		if slices.Contains(reservedLabels, name) {
+			return fmt.Errorf("label %q is already used by the exporter", name)
+		}
+	}
+	return nil
+}
+
+// defaultConfigFiles are searched in order when -config.file is not given.
+var defaultConfigFiles = []string{
+	"config.yaml",
+	"/etc/cheap-switch-exporter/config.yaml",
+}
+
+// findConfigFile returns the first default config file that exists, or the
+// first candidate so the error names a sensible path.
+func findConfigFile() string {
+	for _, name := range defaultConfigFiles {
+		if _, err := os.Stat(name); err == nil {
+			return name
+		}
+	}
+	return defaultConfigFiles[0]
+}
+
+// readConfig reads a config file, or every *.yaml and *.yml file of a
+// directory in lexical order. Later files override the fields they set;
+// maps such as port_roles are merged key by key, lists are replaced. The
+// name "-" reads the config from stdin.
+func readConfig(filename string) (Config, error) {
+	if filename == "-" {
+		return readConfigFrom(os.Stdin)
+	}
+
+	var config Config
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return config, err
+	}
+	files := []string{filename}
+	if info.IsDir() {
+		if files, err = configDirFiles(filename); err != nil {
+			return config, err
+		}
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return config, err
+		}
+		if err := yaml.Unmarshal(data, &config); err != nil {
+			return config, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+
+	return config, nil
+}
+
+// readConfigFrom reads a config from r, which must not be empty.
+func readConfigFrom(r io.Reader) (Config, error) {
+	var config Config
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return config, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return config, errors.New("no configuration on stdin")
+	}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("stdin: %w", err)
+	}
+	return config, nil
+}
+
+func configDirFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(dir, entry.Name()))
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no .yaml files in %s", dir)
+	}
+	return files, nil
+}
+
+// withModule returns a copy of config with the fields set in module
+// overriding it. Maps are copied first so the module cannot change config.
+func (config Config) withModule(module yaml.Node) (Config, error) {
+	config.Labels = maps.Clone(config.Labels)
+	config.PortRoles = maps.Clone(config.PortRoles)
+	config.FamilyPollRates = maps.Clone(config.FamilyPollRates)
+	config.StateValues = maps.Clone(config.StateValues)
+	config.LinkStatusValues = maps.Clone(config.LinkStatusValues)
+	config.PortLinkSpeeds = maps.Clone(config.PortLinkSpeeds)
+	config.LoginFields = maps.Clone(config.LoginFields)
+	config.RequestHeaders = maps.Clone(config.RequestHeaders)
+	config.MetricOverrides = maps.Clone(config.MetricOverrides)
+
+	if err := module.Decode(&config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// MetricOverride replaces parts of a metric's description. Empty fields
+// keep the default.
+type MetricOverride struct {
+	Name string `yaml:"name"`
+	Help string `yaml:"help"`
+	Type string `yaml:"type"`
+}
+
+// metricValueTypes are the types a metric override can set.
+var metricValueTypes = map[string]prometheus.ValueType{
+	"counter": prometheus.CounterValue,
+	"gauge":   prometheus.GaugeValue,
+	"untyped": prometheus.UntypedValue,
+}
+
+// metricNamePattern is the Prometheus metric name syntax.
+var metricNamePattern = regexp.MustCompile(`^[a-zA-Z_:][a-zA-Z0-9_:]*$`)
+
+func validateMetricOverrides(overrides map[string]MetricOverride) error {
+	for metric, override := range overrides {
+		if override.Name != "" && !metricNamePattern.MatchString(override.Name) {
+			return fmt.Errorf("metric_overrides %s: invalid name %q", metric, override.Name)
+		}
+		if _, ok := metricValueTypes[override.Type]; override.Type != "" && !ok {
+			return fmt.Errorf("metric_overrides %s: unknown type %q", metric, override.Type)
+		}
+	}
+	return nil
+}
+
+// applyDefaults sets default values for fields not specified.
+func applyDefaults(config *Config) {
+	normalizeAddress(config)
+	if config.PollRate == 0 {
+		config.PollRate = 10 // Default 10 seconds
+	}
+	if config.CollectMode == "" {
+		config.CollectMode = "web"
+	}
+	if config.AuthMode == "" {
+		config.AuthMode = "form"
+	}
+	if config.MaxPorts == 0 {
+		config.MaxPorts = 64
+	}
+	if config.MaxSwitchRequests == 0 {
+		config.MaxSwitchRequests = 1
+	}
+	if config.CounterWidthBits == 0 {
+		config.CounterWidthBits = 64
+	}
+	if config.LogRepeatInterval == 0 {
+		config.LogRepeatInterval = 300
+	}
+	if config.RedirectPolicy == "" {
+		config.RedirectPolicy = "follow"
+	}
+	if config.FormPlacement == "" {
+		config.FormPlacement = "body"
+	}
+	if config.FormContentType == "" {
+		config.FormContentType = "application/x-www-form-urlencoded"
+	}
+	if config.NumberFormat == "" {
+		config.NumberFormat = "plain"
+	}
+	applyModelProfile(config)
+	if config.StatsPath == "" {
+		config.StatsPath = defaultStatsPath
+	}
+	if config.TableSelector == "" {
+		config.TableSelector = defaultTableSelector
+	}
+	if config.SwitchTimeLayout == "" {
+		config.SwitchTimeLayout = defaultSwitchTimeLayout
+	}
+	if config.SNMPCommunity == "" {
+		config.SNMPCommunity = "public"
+	}
+	if config.SNMPPort == 0 {
+		config.SNMPPort = 161
+	}
+	if config.SNMPVersion == "" {
+		config.SNMPVersion = "2c"
+	}
+	if config.TelnetPort == 0 {
+		config.TelnetPort = 23
+	}
+	if config.TelnetUsernamePrompt == "" {
+		config.TelnetUsernamePrompt = `(?i)(user ?name|login):\s*$`
+	}
+	if config.TelnetPasswordPrompt == "" {
+		config.TelnetPasswordPrompt = `(?i)password:\s*$`
+	}
+	if config.TelnetPrompt == "" {
+		config.TelnetPrompt = `[>#]\s*$`
+	}
+	if config.TelnetMorePrompt == "" {
+		config.TelnetMorePrompt = `(?i)-+\s*\(?more\)?[^\n]*?-+`
+	}
+	if config.TelnetCommand == "" {
+		config.TelnetCommand = "show interface counters"
+	}
+	if config.TelnetPortPattern == "" {
+		config.TelnetPortPattern = defaultPortLinePattern
+	}
+	if config.StatsFormat == "" {
+		config.StatsFormat = "table"
+	}
+	if config.TextSelector == "" {
+		config.TextSelector = "pre, textarea"
+	}
+	if config.TextPortPattern == "" {
+		config.TextPortPattern = defaultPortLinePattern
+	}
+	if config.StatusPollRate == 0 {
+		config.StatusPollRate = 60 // Default 60 seconds
+	}
+	if config.MaxConsecutiveFailures == 0 {
+		config.MaxConsecutiveFailures = 3
+	}
+	if config.MaxLabelLength == 0 {
+		config.MaxLabelLength = 64
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 // Default 5 seconds
+	}
+	if config.ConnectTimeout == 0 {
+		config.ConnectTimeout = config.Timeout // Default to the overall timeout
+	}
+	if config.WebReadTimeout == 0 {
+		config.WebReadTimeout = 10
+	}
+	if config.WebWriteTimeout == 0 {
+		config.WebWriteTimeout = 30
+	}
+	if config.WebIdleTimeout == 0 {
+		config.WebIdleTimeout = 60
+	}
+	if config.WebMaxRequests == 0 {
+		config.WebMaxRequests = 3
+	}
+	if config.ShutdownTimeout == 0 {
+		config.ShutdownTimeout = 10
+	}
+	if config.InfoPath == "" {
+		config.InfoPath = "/info.cgi"
+	}
+	if config.UptimePath == "" {
+		config.UptimePath = "/info.cgi"
+	}
+	if config.DiscoveryInterval == 0 {
+		config.DiscoveryInterval = 3600
+	}
+	if config.DiscoveryConcurrency == 0 {
+		config.DiscoveryConcurrency = 16
+	}
+	if config.EnvironmentPath == "" {
+		config.EnvironmentPath = "/info.cgi"
+	}
+	if config.SystemPath == "" {
+		config.SystemPath = "/info.cgi"
+	}
+	if config.SessionsPath == "" {
+		config.SessionsPath = "/info.cgi"
+	}
+	if config.CPULabel == "" {
+		config.CPULabel = "CPU"
+	}
+	if config.MemoryLabel == "" {
+		config.MemoryLabel = "Memory"
+	}
+	if config.PortSettingsPath == "" {
+		config.PortSettingsPath = "/port.cgi"
+	}
+	if config.CableDiagPath == "" {
+		config.CableDiagPath = "/cable.cgi"
+	}
+	if config.CableTestPath == "" {
+		config.CableTestPath = "/cable.cgi?cmd=test"
+	}
+	if config.MTUPath == "" {
+		config.MTUPath = "/port.cgi"
+	}
+	if config.LoopStatusPath == "" {
+		config.LoopStatusPath = "/loop.cgi"
+	}
+	if config.DetailedStatsPath == "" {
+		config.DetailedStatsPath = "/port.cgi?page=detail"
+	}
+	if config.VLANPath == "" {
+		config.VLANPath = "/vlan.cgi"
+	}
+	if config.MQTTTopicPrefix == "" {
+		config.MQTTTopicPrefix = "switch"
+	}
+	if config.MQTTClientID == "" {
+		config.MQTTClientID = "cheap-switch-exporter"
+	}
+	if config.WebhookMinInterval == 0 {
+		config.WebhookMinInterval = 60
+	}
+	if config.GraphitePrefix == "" {
+		config.GraphitePrefix = "switch"
+	}
+	if config.ClearCountersPath == "" {
+		config.ClearCountersPath = "/port.cgi?page=stats&cmd=clear"
+	}
+	if config.RebootPath == "" {
+		config.RebootPath = "/reboot.cgi"
+	}
+	if config.RebootGrace == 0 {
+		config.RebootGrace = 180
+	}
+	if config.PortAbsentGrace == 0 {
+		// A single fetch without the port is not enough to forget it
+		config.PortAbsentGrace = 3 * config.PollRate
+	}
+}
+
+// validateConfig checks a config after defaults have been applied.
+func validateConfig(config Config) error {
+	switch config.CollectMode {
+	case "web":
+		// Discovery may find every switch on its own
+		if config.Address == "" && !config.DiscoveryEnabled {
+			return errors.New("missing required configuration fields")
+		}
+		switch config.AuthMode {
+		case "form":
+			if config.Username == "" || config.Password == "" {
+				return errors.New("missing required configuration fields")
+			}
+		case "bearer":
+			if config.APIToken == "" {
+				return errors.New("auth_mode bearer requires api_token")
+			}
+		default:
+			return fmt.Errorf("unknown auth_mode %q", config.AuthMode)
+		}
+	case "snmp":
+		if config.Address == "" {
+			return errors.New("missing required configuration fields")
+		}
+		if config.SNMPVersion != "1" && config.SNMPVersion != "2c" {
+			return fmt.Errorf("unsupported snmp_version %q", config.SNMPVersion)
+		}
+	case "telnet":
+		if config.Address == "" || config.Password == "" {
+			return errors.New("missing required configuration fields")
+		}
+		if err := validateTelnetConfig(config); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown collect_mode %q", config.CollectMode)
+	}
+	if config.PollRate <= 0 || config.StatusPollRate <= 0 {
+		return errors.New("poll_rate_seconds and status_poll_rate_seconds must be positive")
+	}
+	if config.PortAbsentGrace < 0 {
+		return errors.New("port_absent_grace_seconds must not be negative")
+	}
+	if config.MaxLabelLength < 0 {
+		return errors.New("max_label_length must not be negative")
+	}
+	if config.SmoothingAlpha < 0 || config.SmoothingAlpha > 1 {
+		return errors.New("smoothing_alpha must be between 0 and 1")
+	}
+	if config.RedirectPolicy != "follow" && config.RedirectPolicy != "error" {
+		return fmt.Errorf("unknown redirect_policy %q", config.RedirectPolicy)
+	}
+	if config.FormPlacement != "body" && config.FormPlacement != "query" {
+		return fmt.Errorf("unknown form_placement %q", config.FormPlacement)
+	}
+	if strings.ContainsAny(config.FormContentType, "\r\n") {
+		return errors.New("invalid form_content_type")
+	}
+	if config.SaturationThreshold < 0 || config.SaturationThreshold > 1 {
+		return errors.New("saturation_threshold must be between 0 and 1")
+	}
+	if config.UtilizationEMAAlpha < 0 || config.UtilizationEMAAlpha > 1 {
+		return errors.New("utilization_ema_alpha must be between 0 and 1")
+	}
+	if config.MaxPorts < 0 {
+		return errors.New("max_ports must not be negative")
+	}
+	if config.CounterWidthBits != 32 && config.CounterWidthBits != 64 {
+		return fmt.Errorf("counter_width_bits must be 32 or 64, got %d", config.CounterWidthBits)
+	}
+	if config.CounterWidthBits == 32 && config.CountersResetOnRead {
+		return errors.New("counter_width_bits 32 cannot be combined with counters_reset_on_read")
+	}
+	if config.MaxSwitchRequests < 0 {
+		return errors.New("max_switch_requests must not be negative")
+	}
+	if config.StartupDelay < 0 || config.StartupJitter < 0 {
+		return errors.New("startup_delay_seconds and startup_jitter_seconds must not be negative")
+	}
+	if config.WebMaxRequests < 0 {
+		return errors.New("web_max_requests_in_flight must not be negative")
+	}
+	if config.EnableControl && (config.WebUsername == "" || config.WebPassword == "") {
+		return errors.New("enable_control requires web_username and web_password")
+	}
+	if config.EnableProbe {
+		if err := validateProbe(config); err != nil {
+			return err
+		}
+	}
+	if err := validateAddress(config.Address); err != nil {
+		return fmt.Errorf("invalid address: %w", err)
+	}
+	if err := validateFamilyPollRates(config.FamilyPollRates); err != nil {
+		return err
+	}
+	if err := validateLabels(config.Labels); err != nil {
+		return err
+	}
+	if err := validateMetricOverrides(config.MetricOverrides); err != nil {
+		return err
+	}
+	for name := range config.LoginFields {
+		if _, ok := defaultLoginFields[name]; !ok {
+			return fmt.Errorf("unknown login_fields entry %q", name)
+		}
+	}
+	if _, ok := groupingSeparators[config.NumberFormat]; !ok {
+		return fmt.Errorf("unknown number_format %q", config.NumberFormat)
+	}
+	if err := validateRequestHeaders(config.RequestHeaders); err != nil {
+		return err
+	}
+	if err := validateModel(config.Model); err != nil {
+		return err
+	}
+	if err := validateSelector(config.TableSelector); err != nil {
+		return err
+	}
+	if err := validateTextTable(config); err != nil {
+		return err
+	}
+	if config.SwitchTimestamps && config.SwitchTimeSelector == "" {
+		return errors.New("switch_timestamps requires switch_time_selector")
+	}
+	if config.SwitchTimeSelector != "" {
+		if _, err := cascadia.Compile(config.SwitchTimeSelector); err != nil {
+			return fmt.Errorf("invalid switch_time_selector %q: %w", config.SwitchTimeSelector, err)
+		}
+	}
+	if err := validateStatsPages(config.StatsPages); err != nil {
+		return err
+	}
+	if config.WebhookURL != "" {
+		if u, err := url.Parse(config.WebhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid webhook_url %q", config.WebhookURL)
+		}
+	}
+	if config.SourceAddress != "" {
+		if err := validateSourceAddress(config.SourceAddress); err != nil {
+			return fmt.Errorf("invalid source_address: %w", err)
+		}
+	}
+	if config.SSHHost != "" {
+		if err := validateSSHConfig(config); err != nil {
+			return err
+		}
+	}
+	if config.DiscoveryEnabled {
+		if err := validateDiscovery(config); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
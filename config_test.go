@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidatePollRate(t *testing.T) {
+	for _, edit := range []func(*Config){
+		func(c *Config) { c.PollRate = -5 },
+		func(c *Config) { c.StatusPollRate = -60 },
+	} {
+		config := Config{Address: "192.168.1.1", Username: "admin", Password: "secret"}
+		edit(&config)
+		applyDefaults(&config)
+		if err := validateConfig(config); err == nil {
+			t.Errorf("poll rates %d and %d accepted", config.PollRate, config.StatusPollRate)
+		}
+	}
+}
+
+func TestValidateMaxLabelLength(t *testing.T) {
+	config := Config{Address: "192.168.1.1", Username: "admin", Password: "secret", MaxLabelLength: -1}
+	applyDefaults(&config)
+	if err := validateConfig(config); err == nil {
+		t.Error("negative max_label_length accepted")
+	}
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		want     string
+		basePath string
+		stats    string
+	}{
+		{"10.0.0.1", "10.0.0.1", "", "http://10.0.0.1/port.cgi?page=stats"},
+		{" http://10.0.0.1/ ", "10.0.0.1", "", "http://10.0.0.1/port.cgi?page=stats"},
+		{"HTTP://10.0.0.1:80/", "10.0.0.1:80", "", "http://10.0.0.1:80/port.cgi?page=stats"},
+		{"10.0.0.1:8080/", "10.0.0.1:8080", "", "http://10.0.0.1:8080/port.cgi?page=stats"},
+		{"http://switch.lan/admin/", "switch.lan", "admin/", "http://switch.lan/admin/port.cgi?page=stats"},
+		{"[fd00::1]:80/", "[fd00::1]:80", "", "http://[fd00::1]:80/port.cgi?page=stats"},
+	}
+	for _, tt := range tests {
+		config := testConfig(t, tt.address, nil)
+		if config.Address != tt.want || config.BasePath != tt.basePath {
+			t.Errorf("%q: got address %q and base path %q, want %q and %q",
+				tt.address, config.Address, config.BasePath, tt.want, tt.basePath)
+		}
+		if got := switchURL(config, config.StatsPath); got != tt.stats {
+			t.Errorf("%q: got stats URL %s, want %s", tt.address, got, tt.stats)
+		}
+	}
+}
+
+func TestValidateAddress(t *testing.T) {
+	for _, address := range []string{
+		"https://10.0.0.1",
+		"ftp://10.0.0.1/",
+		"admin:secret@10.0.0.1",
+		"10.0.0.1:0",
+		"10.0.0.1:http",
+		"10.0.0.1:99999",
+		":80",
+	} {
+		config := Config{Address: address, Username: "admin", Password: "secret"}
+		applyDefaults(&config)
+		if err := validateConfig(config); err == nil {
+			t.Errorf("address %q accepted as %q", address, config.Address)
+		}
+	}
+}
+
+func TestReadConfigFrom(t *testing.T) {
+	config, err := readConfigFrom(strings.NewReader("address: 10.0.0.1\nusername: admin\npassword: secret\npoll_rate_seconds: 30\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Address != "10.0.0.1" || config.Username != "admin" || config.PollRate != 30 {
+		t.Errorf("got %+v", config)
+	}
+
+	for _, input := range []string{"", " \n\t\n"} {
+		if _, err := readConfigFrom(strings.NewReader(input)); err == nil || !strings.Contains(err.Error(), "no configuration") {
+			t.Errorf("%q: got error %v, want a missing configuration", input, err)
+		}
+	}
+	if _, err := readConfigFrom(strings.NewReader("address: [")); err == nil {
+		t.Error("malformed YAML accepted")
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// requireAuth wraps a handler with HTTP basic auth when web credentials are
+// configured. Without credentials the handler is returned unchanged.
+func requireAuth(config Config, next http.Handler) http.Handler {
+	if config.WebUsername == "" && config.WebPassword == "" {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		userMatch := subtle.ConstantTimeCompare([]byte(username), []byte(config.WebUsername)) == 1
+		passMatch := subtle.ConstantTimeCompare([]byte(password), []byte(config.WebPassword)) == 1
+		if !ok || !userMatch || !passMatch {
+			w.Header().Set("WWW-Authenticate", `Basic realm="cheap-switch-exporter"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// counterResetHandler clears the switch's port counters through the
+// configured CGI path.
+func counterResetHandler(config Config, collector *PortStatsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := sendSwitchCommand(r.Context(), config, config.ClearCountersPath); err != nil {
+			log.Printf("Error clearing port counters: %v", err)
+			http.Error(w, "Failed to clear port counters", http.StatusBadGateway)
+			return
+		}
+
+		collector.CountersCleared()
+		log.Printf("Port counters cleared on %s", config.Address)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// cableTestHandler starts a cable test on the port named in the path. The
+// results are picked up from the cable diagnostics page on a later scrape.
+func cableTestHandler(config Config, collector *PortStatsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		port := r.PathValue("port")
+		path := config.CableTestPath + querySeparator(config.CableTestPath) + url.Values{"port": {port}}.Encode()
+		if err := sendSwitchCommand(r.Context(), config, path); err != nil {
+			log.Printf("Error starting cable test on %s: %v", port, err)
+			http.Error(w, "Failed to start cable test", http.StatusBadGateway)
+			return
+		}
+
+		collector.StatusPagesChanged()
+		log.Printf("Cable test started on %s port %q", config.Address, port)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// rebootHandler restarts the switch. As the reboot cannot be undone, the
+// request must carry confirm=yes.
+func rebootHandler(config Config, collector *PortStatsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if r.URL.Query().Get("confirm") != "yes" {
+			http.Error(w, "Rebooting the switch requires confirm=yes", http.StatusBadRequest)
+			return
+		}
+
+		if err := sendSwitchCommand(r.Context(), config, config.RebootPath); err != nil {
+			log.Printf("Error rebooting switch: %v", err)
+			http.Error(w, "Failed to reboot switch", http.StatusBadGateway)
+			return
+		}
+
+		collector.Rebooting()
+		log.Printf("Reboot of %s requested", config.Address)
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+func querySeparator(path string) string {
+	if strings.Contains(path, "?") {
+		return "&"
+	}
+	return "?"
+}
+
+// sendSwitchCommand posts the login form to a CGI path that performs an
+// action on the switch.
+func sendSwitchCommand(ctx context.Context, config Config, path string) error {
+	release, err := acquireSwitch(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer release()
+	client := newHTTPClient(config)
+
+	req, err := newSwitchRequest(ctx, config, "POST", path)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// portCounters are the counters of a port, as read from the switch or as
+// running totals for counters_reset_on_read and counter_width_bits 32.
+type portCounters struct {
+	TxGoodPkt   uint64 `json:"tx_good_pkt"`
+	RxGoodPkt   uint64 `json:"rx_good_pkt"`
+	RxGoodBytes uint64 `json:"rx_good_bytes"`
+	TxGoodBytes uint64 `json:"tx_good_bytes"`
+}
+
+func countersOf(port Port) portCounters {
+	return portCounters{
+		TxGoodPkt:   port.TxGoodPkt,
+		RxGoodPkt:   port.RxGoodPkt,
+		RxGoodBytes: port.RxGoodBytes,
+		TxGoodBytes: port.TxGoodBytes,
+	}
+}
+
+// apply replaces the counters of port with p.
+func (p portCounters) apply(port *Port) {
+	port.TxGoodPkt = p.TxGoodPkt
+	port.RxGoodPkt = p.RxGoodPkt
+	port.RxGoodBytes = p.RxGoodBytes
+	port.TxGoodBytes = p.TxGoodBytes
+}
+
+// add returns p with each counter increased by the one in delta.
+func (p portCounters) add(delta portCounters) portCounters {
+	return portCounters{
+		TxGoodPkt:   p.TxGoodPkt + delta.TxGoodPkt,
+		RxGoodPkt:   p.RxGoodPkt + delta.RxGoodPkt,
+		RxGoodBytes: p.RxGoodBytes + delta.RxGoodBytes,
+		TxGoodBytes: p.TxGoodBytes + delta.TxGoodBytes,
+	}
+}
+
+// accumulateCounters adds the counters of stats, which the switch cleared
+// as it served them, to the running totals and returns stats carrying the
+// totals instead.
+func (c *PortStatsCollector) accumulateCounters(stats PortStatistics) PortStatistics {
+	if c.counterTotals == nil {
+		c.counterTotals = make(map[string]portCounters, len(stats.Ports))
+	}
+
+	seen := make(map[string]bool, len(stats.Ports))
+	for i := range stats.Ports {
+		port := &stats.Ports[i]
+		// Duplicates are dropped when exporting; do not count them twice
+		if seen[port.Name] {
+			continue
+		}
+		seen[port.Name] = true
+
+		total := c.counterTotals[port.Name].add(countersOf(*port))
+		c.counterTotals[port.Name] = total
+		total.apply(port)
+	}
+	return stats
+}
+
+// unwrapCounters extends the 32-bit counters of stats, fetched at now, to
+// running 64-bit totals for counter_width_bits 32 and returns stats carrying
+// the totals instead. A counter lower than on the previous fetch is taken to
+// have wrapped if the increase this implies is plausible, see wrapLimits,
+// and to have been reset otherwise. A port without a previous fetch, e.g.
+// after a deliberate clear, adds its counters from zero.
+func (c *PortStatsCollector) unwrapCounters(stats PortStatistics, now time.Time) PortStatistics {
+	if c.counterTotals == nil {
+		c.counterTotals = make(map[string]portCounters, len(stats.Ports))
+	}
+	previous := c.counterRaw
+	c.counterRaw = make(map[string]portCounters, len(stats.Ports))
+
+	for i := range stats.Ports {
+		port := &stats.Ports[i]
+		// Duplicates are dropped when exporting; do not count them twice
+		if _, ok := c.counterRaw[port.Name]; ok {
+			continue
+		}
+		raw := countersOf(*port)
+		c.counterRaw[port.Name] = raw
+
+		prev := previous[port.Name]
+		packets, bytes := c.wrapLimits(port.Name, now)
+		total := c.counterTotals[port.Name].add(portCounters{
+			TxGoodPkt:   wrappedDelta(raw.TxGoodPkt, prev.TxGoodPkt, packets),
+			RxGoodPkt:   wrappedDelta(raw.RxGoodPkt, prev.RxGoodPkt, packets),
+			RxGoodBytes: wrappedDelta(raw.RxGoodBytes, prev.RxGoodBytes, bytes),
+			TxGoodBytes: wrappedDelta(raw.TxGoodBytes, prev.TxGoodBytes, bytes),
+		})
+		c.counterTotals[port.Name] = total
+		total.apply(port)
+	}
+	return stats
+}
+
+// nearWrapRange is how close to 2^32 a counter must have been, plus how far
+// past zero it may have got, for a drop to count as a wrap when the link
+// speed or the time since the previous fetch is unknown.
+const nearWrapRange = 1 << 30
+
+// minFrameBits is the smallest Ethernet frame on the wire, including the
+// preamble and inter-frame gap, which bounds the packet rate of a link.
+const minFrameBits = 84 * 8
+
+// wrapSlack allows for the switch updating its counters at other times
+// than the exporter fetches them.
+const wrapSlack = 1.5
+
+// wrapLimits returns the largest packet and byte increases the link of the
+// port can carry since its previous fetch. Without a link speed or a
+// previous fetch time, only counters near 2^32 may wrap.
+func (c *PortStatsCollector) wrapLimits(name string, now time.Time) (packets, bytes uint64) {
+	sample, ok := c.samples[name]
+	speed, known := c.linkSpeedMbps(name)
+	seconds := now.Sub(sample.At).Seconds()
+	if !ok || !known || speed <= 0 || seconds <= 0 {
+		return nearWrapRange, nearWrapRange
+	}
+	bits := speed * 1e6 * seconds * wrapSlack
+	return uint64(bits / minFrameBits), uint64(bits / 8)
+}
+
+// wrappedDelta is the increase of a 32-bit counter from prev to cur. A drop
+// is taken for a wrap if the increase across 2^32 is at most limit, and for
+// a reset otherwise, as is a value beyond 32 bits, which cannot have
+// wrapped.
+func wrappedDelta(cur, prev, limit uint64) uint64 {
+	switch {
+	case cur >= prev:
+		return cur - prev
+	case prev <= math.MaxUint32 && cur <= math.MaxUint32:
+		if delta := cur + math.MaxUint32 + 1 - prev; delta <= limit {
+			return delta
+		}
+	}
+	return cur
+}
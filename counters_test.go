@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWrappedDelta(t *testing.T) {
+	tests := []struct {
+		name            string
+		cur, prev, want uint64
+		limit           uint64
+	}{
+		{"increase", 500, 200, 300, 0},
+		{"unchanged", 200, 200, 0, 0},
+		{"wrap", 100, math.MaxUint32 - 99, 200, nearWrapRange},
+		{"wrap at the limit", 0, math.MaxUint32 - 99, 100, 100},
+		{"wrap beyond the limit", 1, math.MaxUint32 - 99, 1, 100},
+		{"reset far from 2^32", 100, 2_000_000_000, 100, nearWrapRange},
+		{"reset above 32 bits", 100, math.MaxUint32 + 1, 100, math.MaxUint64},
+	}
+	for _, tt := range tests {
+		if got := wrappedDelta(tt.cur, tt.prev, tt.limit); got != tt.want {
+			t.Errorf("%s: wrappedDelta(%d, %d, %d) = %d, want %d", tt.name, tt.cur, tt.prev, tt.limit, got, tt.want)
+		}
+	}
+}
+
+func TestAccumulateCounters(t *testing.T) {
+	collector := NewPortStatsCollector(testConfig(t, "192.168.1.1", func(c *Config) {
+		c.CountersResetOnRead = true
+	}), prometheus.NewRegistry())
+
+	reads := []PortStatistics{
+		{Ports: []Port{{Name: "Port 1", TxGoodPkt: 10, RxGoodBytes: 1000}, {Name: "Port 2", RxGoodPkt: 1}}},
+		{Ports: []Port{{Name: "Port 1", TxGoodPkt: 5, RxGoodBytes: 0}, {Name: "Port 2"}}},
+		// A duplicated row must not be counted twice
+		{Ports: []Port{{Name: "Port 1", TxGoodPkt: 1, RxGoodBytes: 24}, {Name: "Port 1", TxGoodPkt: 1, RxGoodBytes: 24}}},
+	}
+	want := [][]portCounters{
+		{{TxGoodPkt: 10, RxGoodBytes: 1000}, {RxGoodPkt: 1}},
+		{{TxGoodPkt: 15, RxGoodBytes: 1000}, {RxGoodPkt: 1}},
+		{{TxGoodPkt: 16, RxGoodBytes: 1024}, {TxGoodPkt: 1, RxGoodBytes: 24}},
+	}
+	for i, read := range reads {
+		stats := collector.accumulateCounters(read)
+		for j, port := range stats.Ports {
+			if got := countersOf(port); got != want[i][j] {
+				t.Errorf("read %d, %s: got %+v, want %+v", i, port.Name, got, want[i][j])
+			}
+		}
+	}
+	if got := collector.counterTotals["Port 2"]; got != (portCounters{RxGoodPkt: 1}) {
+		t.Errorf("got Port 2 total %+v while it was missing", got)
+	}
+}
+
+func TestCountersResetOnReadMetrics(t *testing.T) {
+	router, collector, _ := newFakeRouter(testConfig(t, "192.168.1.1", func(c *Config) {
+		c.CountersResetOnRead = true
+	}))
+	for range 3 {
+		// Every scrape reads the switch, which hands out the same deltas
+		collector.statsExpired = true
+		get(t, router, "/metrics")
+	}
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`# TYPE port_tx_good_pkt counter`,
+		`port_tx_good_pkt{port="Port 1",role="unknown"} 30`,
+		`port_rx_good_bytes{port="Port 1",role="unknown"} 9000`,
+	)
+}
+
+func TestUnwrapCounters(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", func(c *Config) {
+		c.CounterWidthBits = 32
+		c.PortLinkSpeeds = map[string]float64{"fast": 1000, "slow": 10}
+	})
+	collector := NewPortStatsCollector(config, prometheus.NewRegistry())
+
+	start := time.Now()
+	var totals map[string]uint64
+	// fetch feeds raw byte counters to the collector and returns how much
+	// each running total grew
+	fetch := func(after time.Duration, bytes map[string]uint64) map[string]uint64 {
+		var stats PortStatistics
+		for name, value := range bytes {
+			stats.Ports = append(stats.Ports, Port{Name: name, RxGoodBytes: value})
+		}
+		stats = collector.unwrapCounters(stats, start.Add(after))
+		collector.updateUtilization(stats, start.Add(after))
+		growth := map[string]uint64{}
+		for _, port := range stats.Ports {
+			growth[port.Name] = port.RxGoodBytes - totals[port.Name]
+			totals[port.Name] = port.RxGoodBytes
+		}
+		return growth
+	}
+	totals = map[string]uint64{}
+
+	fetch(0, map[string]uint64{
+		"fast":    math.MaxUint32 - 999_999,
+		"slow":    math.MaxUint32 - 999_999,
+		"unknown": math.MaxUint32 - 999_999,
+		"far":     2_000_000_000,
+	})
+	// 2 MB in 10s fit both links, and the unknown one was near 2^32
+	growth := fetch(10*time.Second, map[string]uint64{
+		"fast":    1_000_000,
+		"slow":    1_000_000,
+		"unknown": 1_000_000,
+		"far":     5,
+	})
+	want := map[string]uint64{"fast": 2_000_000, "slow": 2_000_000, "unknown": 2_000_000, "far": 5}
+	for name, n := range want {
+		if growth[name] != n {
+			t.Errorf("%s: total grew by %d, want %d", name, growth[name], n)
+		}
+	}
+
+	fetch(20*time.Second, map[string]uint64{"fast": 4_000_000_000, "slow": 4_000_000_000})
+	// 300 MB in 10s are too much for 10 Mbps, fine for 1 Gbps
+	growth = fetch(30*time.Second, map[string]uint64{"fast": 5_032_704, "slow": 5_032_704})
+	if n := growth["fast"]; n != 300_000_000 {
+		t.Errorf("fast: total grew by %d, want a wrap of 300000000", n)
+	}
+	if n := growth["slow"]; n != 5_032_704 {
+		t.Errorf("slow: total grew by %d, want a reset to 5032704", n)
+	}
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// discoveryTargetLabel is added to every metric of a discovered switch, to
+// tell it apart from the other switches on /metrics.
+const discoveryTargetLabel = "target"
+
+// maxDiscoveryHosts caps the addresses of one CIDR, e.g. a /22 for IPv4.
+// At the default timeout and concurrency a sweep of unresponsive hosts
+// takes a few minutes.
+const (
+	maxDiscoveryHostBits = 10
+	maxDiscoveryHosts    = 1 << maxDiscoveryHostBits
+)
+
+// maxLoginPageSize bounds how much of an unknown host's answer is read.
+const maxLoginPageSize = 1 << 20
+
+var discoveredSwitches = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "exporter_discovered_switches",
+	Help: "Number of switches found by discovery and scraped on /metrics",
+})
+
+// discovery keeps a collector for every switch found in discovery_cidrs.
+// Switches stay once found, so one that goes down reports switch_up 0
+// instead of vanishing.
+type discovery struct {
+	// registry holds the self-metrics of the discovered collectors, whose
+	// target label would clash with those of the configured switch.
+	registry *prometheus.Registry
+
+	mutex      sync.Mutex
+	config     Config
+	collectors map[string]*PortStatsCollector
+}
+
+func newDiscovery(config Config) *discovery {
+	return &discovery{
+		registry:   prometheus.NewRegistry(),
+		config:     config,
+		collectors: make(map[string]*PortStatsCollector),
+	}
+}
+
+// Run discovers switches every discovery interval until ctx is done.
+func (d *discovery) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(d.config.DiscoveryInterval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		d.discover(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// discover probes every host not yet known, at most discovery_concurrency
+// at once, and adds a collector for each one serving a stats page.
+func (d *discovery) discover(ctx context.Context) {
+	d.mutex.Lock()
+	config := d.config
+	var hosts []string
+	for _, host := range discoveryHosts(config.DiscoveryCIDRs) {
+		if _, ok := d.collectors[host]; !ok && host != config.Address {
+			hosts = append(hosts, host)
+		}
+	}
+	d.mutex.Unlock()
+
+	start := time.Now()
+	found := make(chan string)
+	work := make(chan string)
+	var wg sync.WaitGroup
+	for range config.DiscoveryConcurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for host := range work {
+				if probeSwitch(ctx, targetConfig(config, host)) {
+					found <- host
+				}
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for _, host := range hosts {
+			select {
+			case work <- host:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(found)
+	}()
+
+	var added []string
+	for host := range found {
+		added = append(added, host)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	for _, host := range added {
+		// Reloads since the probes started apply to the new collectors too
+		d.collectors[host] = NewPortStatsCollector(targetConfig(d.config, host), d.registry)
+	}
+	discoveredSwitches.Set(float64(len(d.collectors)))
+	if len(added) > 0 {
+		slices.Sort(added)
+		log.Printf("Discovered %d new switches in %s: %v", len(added), time.Since(start).Round(time.Second), added)
+	}
+}
+
+// Reload switches the discovered collectors to config. The discovery
+// settings themselves keep their startup values.
+func (d *discovery) Reload(config Config) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	d.config = config
+	for host, collector := range d.collectors {
+		collector.Reload(targetConfig(config, host))
+	}
+}
+
+// Collectors returns the discovered collectors ordered by address.
+func (d *discovery) Collectors() []*PortStatsCollector {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	collectors := make([]*PortStatsCollector, 0, len(d.collectors))
+	for _, host := range slices.Sorted(maps.Keys(d.collectors)) {
+		collectors = append(collectors, d.collectors[host])
+	}
+	return collectors
+}
+
+// targetConfig is config for the discovered switch at host.
+func targetConfig(config Config, host string) Config {
+	config.Address = host
+	config.Labels = maps.Clone(config.Labels)
+	if config.Labels == nil {
+		config.Labels = map[string]string{}
+	}
+	config.Labels[discoveryTargetLabel] = host
+	return config
+}
+
+// probeSwitch reports whether the host in config serves a stats page with
+// at least one port. The credentials are only sent to hosts whose login
+// page looks like that of a switch.
+func probeSwitch(ctx context.Context, config Config) bool {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(config.Timeout)*time.Second)
+	defer cancel()
+
+	if err := fingerprintSwitch(ctx, config); err != nil {
+		debugf("Discovery probe of %s: %v", config.Address, err)
+		return false
+	}
+	// Hosts that are not added must not keep their request slots around
+	stats, err := fetchPortStatistics(ctx, config)
+	if err != nil {
+		forgetSwitch(config.Address)
+		debugf("Discovery probe of %s: %v", config.Address, err)
+		return false
+	}
+	if len(stats.Ports) == 0 {
+		forgetSwitch(config.Address)
+		return false
+	}
+	return true
+}
+
+// fingerprintSwitch requests the index page of the host in config without
+// credentials or request_headers and checks it is a login form with the
+// configured fields. It bypasses the request slots, which would otherwise be
+// kept for every address swept.
+func fingerprintSwitch(ctx context.Context, config Config) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", switchURL(config, "/"), nil)
+	if err != nil {
+		return err
+	}
+
+	client := newHTTPClient(config)
+	// The index page of most firmware redirects to the login page, but
+	// the credentials must not follow a redirect to another host
+	client.CheckRedirect = func(next *http.Request, via []*http.Request) error {
+		if next.URL.Host != req.URL.Host || len(via) >= 3 {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(io.LimitReader(resp.Body, maxLoginPageSize))
+	if err != nil {
+		return err
+	}
+	if !isLoginForm(doc, config) {
+		return errors.New("no switch login page")
+	}
+	return nil
+}
+
+// isLoginForm reports whether doc has a form with a password input and the
+// username, password and response fields of the login_fields config.
+func isLoginForm(doc *goquery.Document, config Config) bool {
+	found := false
+	doc.Find("form").EachWithBreak(func(_ int, form *goquery.Selection) bool {
+		if form.Find(`input[type="password"]`).Length() == 0 {
+			return true
+		}
+		found = true
+		for _, name := range []string{"username", "password", "response"} {
+			field := loginField(config, name)
+			if field != "" && form.Find(fmt.Sprintf("input[name=%q]", field)).Length() == 0 {
+				found = false
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// discoveryHosts expands the CIDRs into host addresses, leaving out the
+// network and broadcast addresses of IPv4 subnets.
+func discoveryHosts(cidrs []string) []string {
+	var hosts []string
+	seen := make(map[netip.Addr]bool)
+	for _, cidr := range cidrs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			continue
+		}
+		prefix = prefix.Masked()
+		first, last := prefix.Addr(), lastAddr(prefix)
+		if prefix.Addr().Is4() && prefix.Bits() < 31 {
+			first, last = first.Next(), last.Prev()
+		}
+		for addr := first; addr.IsValid() && addr.Compare(last) <= 0; addr = addr.Next() {
+			// Overlapping CIDRs must not yield a switch twice
+			if !seen[addr] {
+				seen[addr] = true
+				hosts = append(hosts, addr.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// lastAddr is the highest address in prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	bytes := prefix.Addr().AsSlice()
+	for bit := prefix.Bits(); bit < len(bytes)*8; bit++ {
+		bytes[bit/8] |= 0x80 >> (bit % 8)
+	}
+	addr, _ := netip.AddrFromSlice(bytes)
+	return addr
+}
+
+func validateDiscovery(config Config) error {
+	if config.CollectMode != "web" {
+		return errors.New("discovery_enabled needs collect_mode web")
+	}
+	if config.SSHHost != "" {
+		return errors.New("discovery_enabled and ssh_host cannot be combined")
+	}
+	if config.AuthMode != "form" {
+		// Hosts are only sent credentials after showing a login form
+		return errors.New("discovery_enabled needs auth_mode form")
+	}
+	if len(config.DiscoveryCIDRs) == 0 {
+		return errors.New("discovery_enabled requires discovery_cidrs")
+	}
+	if _, ok := config.Labels[discoveryTargetLabel]; ok {
+		return fmt.Errorf("label %q is set by discovery", discoveryTargetLabel)
+	}
+	if config.DiscoveryInterval < 0 || config.DiscoveryConcurrency < 0 {
+		return errors.New("discovery_interval_seconds and discovery_concurrency must be positive")
+	}
+	for _, cidr := range config.DiscoveryCIDRs {
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return fmt.Errorf("invalid discovery_cidrs entry %q: %w", cidr, err)
+		}
+		if prefix.Addr().BitLen()-prefix.Bits() > maxDiscoveryHostBits {
+			return fmt.Errorf("discovery_cidrs entry %q has more than %d addresses", cidr, maxDiscoveryHosts)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestProbeSwitch(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	if !probeSwitch(context.Background(), testConfig(t, sw.Address(), nil)) {
+		t.Fatal("fake switch not discovered")
+	}
+	want := []string{"/", "/port.cgi?page=stats"}
+	if got := sw.Requests(); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("got requests %v, want %v", got, want)
+	}
+}
+
+func TestProbeSwitchSkipsOtherHosts(t *testing.T) {
+	var requests []*http.Request
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r)
+		bodies = append(bodies, string(body))
+		w.Write([]byte(`<html><body><form action="/search"><input name="q"></form></body></html>`))
+	}))
+	defer server.Close()
+
+	address := strings.TrimPrefix(server.URL, "http://")
+	if probeSwitch(context.Background(), testConfig(t, address, nil)) {
+		t.Error("web server without a login form discovered as a switch")
+	}
+	if len(requests) != 1 {
+		t.Fatalf("got %d requests, want only the index page", len(requests))
+	}
+	if r := requests[0]; len(r.Cookies()) > 0 || r.URL.RawQuery != "" || bodies[0] != "" {
+		t.Errorf("credentials sent to a host that is no switch: %v %q", r.Cookies(), bodies[0])
+	}
+
+	switchSlots.Lock()
+	_, ok := switchSlots.byAddress[address]
+	switchSlots.Unlock()
+	if ok {
+		t.Error("request slots kept for a host that is no switch")
+	}
+}
+
+func TestIsLoginForm(t *testing.T) {
+	tests := []struct {
+		name   string
+		page   string
+		fields map[string]string
+		want   bool
+	}{
+		{"stock login page", readFixture(t, "login.html"), nil, true},
+		{"stats page", readFixture(t, "stats.html"), nil, false},
+		{"other login form", `<form><input name="user"><input name="pass" type="password"></form>`, nil, false},
+		{
+			"other login form with login_fields",
+			`<form><input name="user"><input name="pass" type="password"></form>`,
+			map[string]string{"username": "user", "password": "pass", "response": ""},
+			true,
+		},
+		{"fields outside the password form", `<form><input name="username"><input name="Response"></form>` +
+			`<form><input name="password" type="password"></form>`, nil, false},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := testConfig(t, "192.168.1.1", func(c *Config) { c.LoginFields = tt.fields })
+		if got := isLoginForm(doc, config); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestValidateDiscoveryCIDRs(t *testing.T) {
+	tests := []struct {
+		cidr string
+		ok   bool
+	}{
+		{"10.0.4.0/22", true},
+		{"10.0.5.0/24", true},
+		{"10.0.0.0/21", false},
+		{"10.0.0.0/16", false},
+		{"fd00::/118", true},
+		{"fd00::/64", false},
+		{"10.0.5.0", false},
+	}
+	for _, tt := range tests {
+		config := testConfig(t, "192.168.1.1", nil)
+		config.DiscoveryEnabled = true
+		config.DiscoveryCIDRs = []string{tt.cidr}
+		if err := validateConfig(config); (err == nil) != tt.ok {
+			t.Errorf("discovery_cidrs %q: got error %v", tt.cidr, err)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// applyEnvFile merges KEY=value pairs from a dotenv-style file over config.
+// Keys are the YAML field names in any case, so ADDRESS sets address and
+// POLL_RATE_SECONDS sets poll_rate_seconds.
+func applyEnvFile(filename string, config *Config) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("%s:%d: expected KEY=value", filename, lineNo)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value, style := unquoteEnvValue(strings.TrimSpace(value))
+
+		mapping.Content = append(mapping.Content,
+			&yaml.Node{Kind: yaml.ScalarNode, Value: key},
+			&yaml.Node{Kind: yaml.ScalarNode, Value: value, Style: style},
+		)
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Decoding through a YAML node gives env values the same type handling
+	// as the config file.
+	return mapping.Decode(config)
+}
+
+// unquoteEnvValue strips matching surrounding quotes. Quoted values are
+// always treated as strings.
+func unquoteEnvValue(value string) (string, yaml.Style) {
+	if len(value) >= 2 {
+		switch {
+		case value[0] == '"' && value[len(value)-1] == '"':
+			return value[1 : len(value)-1], yaml.DoubleQuotedStyle
+		case value[0] == '\'' && value[len(value)-1] == '\'':
+			return value[1 : len(value)-1], yaml.SingleQuotedStyle
+		}
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, 0
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Environment holds the readings found on the system status page. Readings
+// the model does not report are left empty.
+type Environment struct {
+	TemperatureCelsius *float64
+	FanRPM             []float64
+}
+
+var numberPattern = regexp.MustCompile(`-?\d+(\.\d+)?`)
+
+func (c *PortStatsCollector) refreshEnvironment(ctx context.Context) {
+	env, err := fetchEnvironment(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching environment status: %v", err)
+		return
+	}
+	c.environment = env
+}
+
+func (c *PortStatsCollector) collectEnvironment(ch chan<- prometheus.Metric) {
+	env := c.environment
+
+	if env.TemperatureCelsius != nil {
+		ch <- c.constMetric(
+			c.switchTemperature, prometheus.GaugeValue,
+			*env.TemperatureCelsius,
+		)
+	}
+	for i, rpm := range env.FanRPM {
+		ch <- c.constMetric(
+			c.switchFanRPM, prometheus.GaugeValue,
+			rpm, strconv.Itoa(i+1),
+		)
+	}
+}
+
+func fetchEnvironment(ctx context.Context, config Config) (Environment, error) {
+	doc, err := fetchDocument(ctx, config, config.EnvironmentPath)
+	if err != nil {
+		return Environment{}, err
+	}
+
+	return parseEnvironment(doc), nil
+}
+
+// parseEnvironment looks for label/value rows mentioning temperature or fan
+// and takes the first number in the value cell.
+func parseEnvironment(doc *goquery.Document) Environment {
+	var env Environment
+
+	eachLabeledRow(doc, func(label, text string) {
+		label = strings.ToLower(label)
+		value, ok := parseNumber(text)
+		if !ok {
+			return
+		}
+
+		switch {
+		case strings.Contains(label, "temperature") && env.TemperatureCelsius == nil:
+			env.TemperatureCelsius = &value
+		case strings.Contains(label, "fan"):
+			env.FanRPM = append(env.FanRPM, value)
+		}
+	})
+
+	return env
+}
+
+// eachLabeledRow calls fn with the text of the first two cells of every table
+// row, which is how status pages lay out their readings.
+func eachLabeledRow(doc *goquery.Document, fn func(label, value string)) {
+	doc.Find("tr").Each(func(i int, s *goquery.Selection) {
+		cells := s.Find("th, td")
+		if cells.Length() < 2 {
+			return
+		}
+		fn(strings.TrimSpace(cells.First().Text()), strings.TrimSpace(cells.Eq(1).Text()))
+	})
+}
+
+func parseNumber(text string) (float64, bool) {
+	match := numberPattern.FindString(text)
+	if match == "" {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(match, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseEnvironment(t *testing.T) {
+	env := parseEnvironment(parseFixture(t, "environment.html"))
+	if env.TemperatureCelsius == nil || *env.TemperatureCelsius != 47.5 {
+		t.Errorf("got temperature %v, want 47.5", env.TemperatureCelsius)
+	}
+	// Fans without a reading are left out
+	if want := []float64{3200, 3150}; !slices.Equal(env.FanRPM, want) {
+		t.Errorf("got fans %v, want %v", env.FanRPM, want)
+	}
+}
+
+func TestParseEnvironmentWithoutFans(t *testing.T) {
+	env := parseEnvironment(parseFixture(t, "environment_nofan.html"))
+	// The first temperature row wins
+	if env.TemperatureCelsius == nil || *env.TemperatureCelsius != 52 {
+		t.Errorf("got temperature %v, want 52", env.TemperatureCelsius)
+	}
+	if env.FanRPM != nil {
+		t.Errorf("got fans %v on a model without fans", env.FanRPM)
+	}
+}
+
+func TestEnvironmentMetrics(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/info.cgi":            readFixture(t, "environment_nofan.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.EnvironmentEnabled = true
+	}))
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `switch_temperature_celsius 52`)
+	if metricFamilyPresent(body, "switch_fan_rpm") {
+		t.Errorf("fan metric exported for a model without fans:\n%s", body)
+	}
+}
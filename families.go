@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// statusFamily is a group of metrics read from one of the slow-changing
+// status pages, refreshed on its own schedule.
+type statusFamily struct {
+	name    string
+	enabled func(Config) bool
+	refresh func(*PortStatsCollector, context.Context)
+	collect func(*PortStatsCollector, chan<- prometheus.Metric)
+}
+
+// statusFamilies are refreshed and collected in this order. The names are
+// the keys of family_poll_rates_seconds.
+var statusFamilies = []statusFamily{
+	{
+		"info",
+		func(c Config) bool { return c.InfoEnabled },
+		(*PortStatsCollector).refreshInfo,
+		(*PortStatsCollector).collectInfo,
+	},
+	{
+		"uptime",
+		func(c Config) bool { return c.UptimeEnabled },
+		(*PortStatsCollector).refreshUptime,
+		(*PortStatsCollector).collectUptime,
+	},
+	{
+		"environment",
+		func(c Config) bool { return c.EnvironmentEnabled },
+		(*PortStatsCollector).refreshEnvironment,
+		(*PortStatsCollector).collectEnvironment,
+	},
+	{
+		"system",
+		func(c Config) bool { return c.SystemEnabled },
+		(*PortStatsCollector).refreshSystemUsage,
+		(*PortStatsCollector).collectSystemUsage,
+	},
+	{
+		"sessions",
+		func(c Config) bool { return c.SessionsEnabled },
+		(*PortStatsCollector).refreshSessions,
+		(*PortStatsCollector).collectSessions,
+	},
+	{
+		"port_speed",
+		func(c Config) bool { return c.PortSpeedEnabled },
+		(*PortStatsCollector).refreshPortSpeeds,
+		(*PortStatsCollector).collectPortSpeeds,
+	},
+	{
+		"cable_diag",
+		func(c Config) bool { return c.CableDiagEnabled },
+		(*PortStatsCollector).refreshCableDiagnostics,
+		(*PortStatsCollector).collectCableDiagnostics,
+	},
+	{
+		"mtu",
+		func(c Config) bool { return c.MTUEnabled },
+		(*PortStatsCollector).refreshFrameSizes,
+		(*PortStatsCollector).collectFrameSizes,
+	},
+	{
+		"loop_status",
+		func(c Config) bool { return c.LoopStatusEnabled },
+		(*PortStatsCollector).refreshLoopStatus,
+		(*PortStatsCollector).collectLoopStatus,
+	},
+	{
+		"frame_errors",
+		func(c Config) bool { return c.FrameErrorsEnabled },
+		(*PortStatsCollector).refreshFrameErrors,
+		(*PortStatsCollector).collectFrameErrors,
+	},
+	{
+		"vlan",
+		func(c Config) bool { return c.CollectVLAN },
+		(*PortStatsCollector).refreshVLANs,
+		(*PortStatsCollector).collectVLANs,
+	},
+}
+
+// familyPollRate is the refresh interval of a status family, defaulting to
+// StatusPollRate.
+func (config Config) familyPollRate(name string) time.Duration {
+	if seconds, ok := config.FamilyPollRates[name]; ok {
+		return time.Duration(seconds) * time.Second
+	}
+	return time.Duration(config.StatusPollRate) * time.Second
+}
+
+// collectStatusFamilies refreshes every enabled family whose interval has
+// elapsed and exports the cached readings of all enabled families. While
+// logins back off after a rejection the status pages are not fetched
+// either, as each of them would log in again. In lightweight mode no
+// family is fetched or exported.
+func (c *PortStatsCollector) collectStatusFamilies(ctx context.Context, ch chan<- prometheus.Metric) {
+	if c.config.Lightweight {
+		return
+	}
+	if c.familyFetchedAt == nil {
+		c.familyFetchedAt = make(map[string]time.Time, len(statusFamilies))
+	}
+
+	for _, family := range statusFamilies {
+		if !family.enabled(c.config) {
+			continue
+		}
+		due := time.Since(c.familyFetchedAt[family.name]) >= c.config.familyPollRate(family.name)
+		if due && !time.Now().Before(c.loginRetryAt) {
+			c.familyFetchedAt[family.name] = time.Now()
+			family.refresh(c, ctx)
+		}
+		family.collect(c, ch)
+	}
+}
+
+func validateFamilyPollRates(rates map[string]int) error {
+	for name, seconds := range rates {
+		known := false
+		for _, family := range statusFamilies {
+			known = known || family.name == name
+		}
+		if !known {
+			return fmt.Errorf("unknown family %q in family_poll_rates_seconds", name)
+		}
+		if seconds < 0 {
+			return fmt.Errorf("negative poll rate for family %q", name)
+		}
+	}
+	return nil
+}
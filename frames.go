@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// frameErrorKinds are the malformed frame counters read from the detailed
+// stats page, each found by a column header containing its name.
+var frameErrorKinds = []string{"oversize", "undersize", "fragment", "jabber"}
+
+// FrameErrors holds the malformed frame counters of one port, by kind. Only
+// kinds the page has a column for are present.
+type FrameErrors struct {
+	Port   string
+	Counts map[string]uint64
+}
+
+func (c *PortStatsCollector) refreshFrameErrors(ctx context.Context) {
+	ports, err := fetchFrameErrors(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching frame error counters: %v", err)
+		return
+	}
+	for i := range ports {
+		ports[i].Port = c.truncateLabel(ports[i].Port)
+	}
+	c.frameErrors = ports
+}
+
+func (c *PortStatsCollector) collectFrameErrors(ch chan<- prometheus.Metric) {
+	descs := map[string]*prometheus.Desc{
+		"oversize":  c.portOversizeFrames,
+		"undersize": c.portUndersizeFrames,
+		"fragment":  c.portFragmentFrames,
+		"jabber":    c.portJabberFrames,
+	}
+
+	seen := map[string]bool{}
+	for _, port := range c.frameErrors {
+		if seen[port.Port] {
+			continue
+		}
+		seen[port.Port] = true
+
+		labels := []string{port.Port, c.portRole(port.Port)}
+		for _, kind := range frameErrorKinds {
+			if count, ok := port.Counts[kind]; ok {
+				ch <- c.constMetric(
+					descs[kind], prometheus.CounterValue,
+					float64(count), labels...,
+				)
+			}
+		}
+	}
+}
+
+func fetchFrameErrors(ctx context.Context, config Config) ([]FrameErrors, error) {
+	doc, err := fetchDocument(ctx, config, config.DetailedStatsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseFrameErrors(doc, config.NumberFormat), nil
+}
+
+// parseFrameErrors reads a per-port table with the port name in the first
+// column, taking the counters from the columns whose headers name a kind in
+// frameErrorKinds.
+func parseFrameErrors(doc *goquery.Document, numberFormat string) []FrameErrors {
+	var ports []FrameErrors
+	kindCols := map[string]int{}
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		if headers := s.Find("th"); headers.Length() > 0 {
+			headers.Each(func(j int, th *goquery.Selection) {
+				text := strings.ToLower(th.Text())
+				for _, kind := range frameErrorKinds {
+					if _, ok := kindCols[kind]; !ok && j > 0 && strings.Contains(text, kind) {
+						kindCols[kind] = j
+					}
+				}
+			})
+			return
+		}
+		if len(kindCols) == 0 {
+			return
+		}
+
+		cells := s.Find("td")
+		port := FrameErrors{Port: strings.TrimSpace(cells.First().Text()), Counts: map[string]uint64{}}
+		if port.Port == "" {
+			return
+		}
+		for kind, col := range kindCols {
+			if col < cells.Length() {
+				port.Counts[kind] = parseStatValue(cells.Eq(col).Text(), groupingSeparators[numberFormat])
+			}
+		}
+		ports = append(ports, port)
+	})
+
+	return ports
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestParseFrameErrors(t *testing.T) {
+	ports := parseFrameErrors(parseFixture(t, "detailed_stats.html"), "comma_grouped")
+	want := []FrameErrors{
+		{Port: "Port 1", Counts: map[string]uint64{"oversize": 3, "undersize": 0, "fragment": 1024, "jabber": 7}},
+		{Port: "Port 2", Counts: map[string]uint64{"oversize": 0, "undersize": 0, "fragment": 0, "jabber": 0}},
+		// A short row leaves out the counters it has no cell for
+		{Port: "Port 3", Counts: map[string]uint64{"oversize": 5, "undersize": 12, "fragment": 0}},
+	}
+	if len(ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(ports), len(want), ports)
+	}
+	for i, port := range ports {
+		if port.Port != want[i].Port || !maps.Equal(port.Counts, want[i].Counts) {
+			t.Errorf("got %+v, want %+v", port, want[i])
+		}
+	}
+}
+
+func TestParseFrameErrorsWithoutColumns(t *testing.T) {
+	if ports := parseFrameErrors(parseFixture(t, "stats.html"), "plain"); ports != nil {
+		t.Errorf("got %+v from a page without frame error columns", ports)
+	}
+}
+
+func TestFrameErrorMetrics(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats":  readFixture(t, "stats.html"),
+		"/port.cgi?page=detail": readFixture(t, "detailed_stats.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.FrameErrorsEnabled = true
+		c.NumberFormat = "comma_grouped"
+	}))
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_oversize_frames_total{port="Port 1",role="unknown"} 3`,
+		`port_fragment_frames_total{port="Port 1",role="unknown"} 1024`,
+		`port_jabber_frames_total{port="Port 1",role="unknown"} 7`,
+		`port_undersize_frames_total{port="Port 3",role="unknown"} 12`,
+	)
+	if strings.Contains(body, `port_jabber_frames_total{port="Port 3"`) {
+		t.Errorf("counter exported for a missing cell:\n%s", body)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var graphiteUnsafe = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// GraphitePublisher writes port statistics in the Graphite plaintext
+// protocol. Writes happen on a background goroutine so Publish never waits
+// for the network; batches arriving while the connection is busy are
+// dropped.
+type GraphitePublisher struct {
+	address     string
+	prefix      string
+	switchName  string
+	timeout     time.Duration
+	stateValues map[string]float64
+	linkValues  map[string]float64
+	batches     chan []string
+	errors      prometheus.Counter
+	conn        net.Conn
+}
+
+func NewGraphitePublisher(config Config, reg prometheus.Registerer) *GraphitePublisher {
+	p := &GraphitePublisher{
+		address:     config.GraphiteAddress,
+		prefix:      strings.Trim(config.GraphitePrefix, "."),
+		switchName:  graphiteUnsafe.ReplaceAllString(config.Address, "_"),
+		timeout:     time.Duration(config.Timeout) * time.Second,
+		stateValues: mergeValues(DefaultStateValues, config.StateValues),
+		linkValues:  mergeValues(DefaultLinkStatusValues, config.LinkStatusValues),
+		batches:     make(chan []string, 1),
+		errors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "exporter_graphite_errors_total",
+			Help: "Number of failed writes to Graphite",
+		}),
+	}
+	go p.run()
+	return p
+}
+
+// Publish formats one line per port metric, e.g.
+// switch.192_168_1_1.Port_1.rx_good_bytes 1234 1700000000
+func (p *GraphitePublisher) Publish(stats PortStatistics) {
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	base := p.prefix + "." + p.switchName
+
+	var lines []string
+	for _, port := range stats.Ports {
+		path := base + "." + graphiteUnsafe.ReplaceAllString(port.Name, "_")
+		values := []struct {
+			name  string
+			value string
+		}{
+			{"state", formatFloat(p.stateValues[port.State])},
+			{"link_status", formatFloat(p.linkValues[port.LinkStatus])},
+			{"tx_good_pkt", strconv.FormatUint(port.TxGoodPkt, 10)},
+			{"rx_good_pkt", strconv.FormatUint(port.RxGoodPkt, 10)},
+			{"tx_good_bytes", strconv.FormatUint(port.TxGoodBytes, 10)},
+			{"rx_good_bytes", strconv.FormatUint(port.RxGoodBytes, 10)},
+		}
+		for _, v := range values {
+			lines = append(lines, path+"."+v.name+" "+v.value+" "+now)
+		}
+	}
+
+	select {
+	case p.batches <- lines:
+	default:
+		p.errors.Inc()
+		log.Printf("Graphite writer busy, dropping %d metrics", len(lines))
+	}
+}
+
+func (p *GraphitePublisher) run() {
+	for lines := range p.batches {
+		if err := p.write(lines); err != nil {
+			p.errors.Inc()
+			log.Printf("Error writing to Graphite: %v", err)
+			// Reconnect on the next batch
+			if p.conn != nil {
+				p.conn.Close()
+				p.conn = nil
+			}
+		}
+	}
+}
+
+func (p *GraphitePublisher) write(lines []string) error {
+	if p.conn == nil {
+		conn, err := net.DialTimeout("tcp", p.address, p.timeout)
+		if err != nil {
+			return err
+		}
+		p.conn = conn
+	}
+
+	if err := p.conn.SetWriteDeadline(time.Now().Add(p.timeout)); err != nil {
+		return err
+	}
+	w := bufio.NewWriter(p.conn)
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// influxEscaper escapes tag keys and values of the InfluxDB line protocol.
+var influxEscaper = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+
+// influxLines renders the port statistics a scrape would serve as one
+// switch_port point per port, e.g.
+// switch_port,port=Port\ 1,switch=192.168.1.1 state=1,...,rx_good_bytes=1234i 1700000000000000000
+// The timestamp is the time the statistics were fetched.
+func (c *PortStatsCollector) influxLines(ctx context.Context) ([]string, bool) {
+	c.lockScrape()
+	defer c.unlockScrape()
+
+	stats, age, ok := c.portStatistics(ctx)
+	if !ok {
+		return nil, false
+	}
+
+	tags := "switch=" + influxEscaper.Replace(c.config.Address)
+	for _, name := range slices.Sorted(maps.Keys(c.config.Labels)) {
+		tags += "," + influxEscaper.Replace(name) + "=" + influxEscaper.Replace(c.config.Labels[name])
+	}
+	timestamp := strconv.FormatInt(time.Now().Add(-age).UnixNano(), 10)
+
+	lines := make([]string, 0, len(stats.Ports))
+	for _, port := range stats.Ports {
+		lines = append(lines, fmt.Sprintf(
+			"switch_port,port=%s,%s state=%s,link_status=%s,tx_good_pkt=%di,rx_good_pkt=%di,tx_good_bytes=%di,rx_good_bytes=%di %s",
+			influxEscaper.Replace(port.Name), tags,
+			formatFloat(c.stateToFloat(port.State)), formatFloat(c.linkStatusToFloat(port.LinkStatus)),
+			port.TxGoodPkt, port.RxGoodPkt, port.TxGoodBytes, port.RxGoodBytes,
+			timestamp,
+		))
+	}
+	return lines, true
+}
+
+// influxHandler serves the port statistics in the InfluxDB line protocol,
+// for collectors such as Telegraf that do not read the Prometheus format.
+func influxHandler(collector *PortStatsCollector) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lines, ok := collector.influxLines(r.Context())
+		if !ok {
+			http.Error(w, "No port statistics available", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	})
+}
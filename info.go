@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// infoLabels are the labels of switch_info, in the order of SwitchInfo.
+var infoLabels = []string{"model", "firmware_version", "hardware_version", "mac_address"}
+
+// SwitchInfo holds the identity of the switch from its system information
+// page. Fields the firmware does not show are left empty.
+type SwitchInfo struct {
+	Model    string
+	Firmware string
+	Hardware string
+	MAC      string
+}
+
+var (
+	uptimeClockPattern = regexp.MustCompile(`(\d+):(\d{2}):(\d{2})`)
+	uptimeUnitPattern  = regexp.MustCompile(`(\d+)\s*(days?|hours?|hrs?|minutes?|mins?|seconds?|secs?|d|h|m|s)\b`)
+)
+
+// uptimeUnits are the seconds per unit of uptimeUnitPattern, by the first
+// letter of the unit.
+var uptimeUnits = map[byte]float64{'d': 86400, 'h': 3600, 'm': 60, 's': 1}
+
+func (c *PortStatsCollector) refreshInfo(ctx context.Context) {
+	doc, err := fetchDocument(ctx, c.config, c.config.InfoPath)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching switch information: %v", err)
+		return
+	}
+	c.info = parseInfo(doc)
+}
+
+func (c *PortStatsCollector) collectInfo(ch chan<- prometheus.Metric) {
+	info := c.info
+	if info == (SwitchInfo{}) {
+		return
+	}
+	ch <- c.constMetric(
+		c.switchInfo, prometheus.GaugeValue, 1,
+		c.truncateLabel(info.Model), c.truncateLabel(info.Firmware),
+		c.truncateLabel(info.Hardware), c.truncateLabel(info.MAC),
+	)
+}
+
+func (c *PortStatsCollector) refreshUptime(ctx context.Context) {
+	doc, err := fetchDocument(ctx, c.config, c.config.UptimePath)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching switch uptime: %v", err)
+		return
+	}
+	c.uptime = parseUptimeRow(doc)
+}
+
+func (c *PortStatsCollector) collectUptime(ch chan<- prometheus.Metric) {
+	if c.uptime != nil {
+		ch <- c.constMetric(
+			c.switchUptime, prometheus.GaugeValue, *c.uptime,
+		)
+	}
+}
+
+// parseInfo takes the first row whose label mentions the model, the
+// firmware or software version, the hardware version or the MAC address.
+func parseInfo(doc *goquery.Document) SwitchInfo {
+	var info SwitchInfo
+
+	eachLabeledRow(doc, func(label, value string) {
+		label = strings.ToLower(label)
+		var field *string
+		switch {
+		case strings.Contains(label, "model") || strings.Contains(label, "device type"):
+			field = &info.Model
+		case strings.Contains(label, "firmware") || strings.Contains(label, "software"):
+			field = &info.Firmware
+		case strings.Contains(label, "hardware"):
+			field = &info.Hardware
+		case strings.Contains(label, "mac"):
+			field = &info.MAC
+		default:
+			return
+		}
+		if *field == "" {
+			*field = value
+		}
+	})
+
+	return info
+}
+
+// parseUptimeRow reads the first row labeled with "uptime" or "up time".
+func parseUptimeRow(doc *goquery.Document) *float64 {
+	var uptime *float64
+	eachLabeledRow(doc, func(label, value string) {
+		label = strings.ToLower(label)
+		if uptime != nil || !strings.Contains(label, "uptime") && !strings.Contains(label, "up time") {
+			return
+		}
+		if seconds, ok := parseUptime(value); ok {
+			uptime = &seconds
+		}
+	})
+	return uptime
+}
+
+// parseUptime understands "3 days, 04:05:06", "1d 2h 3m 4s", "2 hours 5
+// min" and a bare number of seconds.
+func parseUptime(text string) (float64, bool) {
+	text = strings.ToLower(text)
+	var seconds float64
+	found := false
+
+	if match := uptimeClockPattern.FindStringSubmatch(text); match != nil {
+		for i, unit := range []float64{3600, 60, 1} {
+			n, _ := strconv.ParseFloat(match[i+1], 64)
+			seconds += n * unit
+		}
+		text = strings.Replace(text, match[0], "", 1)
+		found = true
+	}
+	for _, match := range uptimeUnitPattern.FindAllStringSubmatch(text, -1) {
+		n, _ := strconv.ParseFloat(match[1], 64)
+		seconds += n * uptimeUnits[match[2][0]]
+		found = true
+	}
+	if found {
+		return seconds, true
+	}
+
+	seconds, err := strconv.ParseFloat(strings.TrimSpace(text), 64)
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	return seconds, true
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestParseInfo(t *testing.T) {
+	info := parseInfo(parseFixture(t, "info.html"))
+	want := SwitchInfo{
+		Model:    "SKS3200-8E1X",
+		Firmware: "V1.0.4 (Build 20230512)",
+		Hardware: "V1.1",
+		MAC:      "1C:2A:A3:00:12:34",
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+}
+
+func TestParseUptime(t *testing.T) {
+	tests := []struct {
+		text string
+		want float64
+		ok   bool
+	}{
+		{"3 days, 04:05:06", 3*86400 + 4*3600 + 5*60 + 6, true},
+		{"1d 2h 3m 4s", 86400 + 2*3600 + 3*60 + 4, true},
+		{"0 Day 1 Hour 2 Min 3 Sec", 3600 + 2*60 + 3, true},
+		{"2 hours 5 mins", 2*3600 + 5*60, true},
+		{"12:00:01", 12*3600 + 1, true},
+		{"86400", 86400, true},
+		{"unknown", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseUptime(tt.text)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseUptime(%q) = %v, %v, want %v, %v", tt.text, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestInfoAndUptimeMetrics(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/info.cgi":            readFixture(t, "info.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.InfoEnabled = true
+		c.UptimeEnabled = true
+		c.FamilyPollRates = map[string]int{"info": 3600}
+	}))
+
+	get(t, router, "/metrics")
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`switch_info{firmware_version="V1.0.4 (Build 20230512)",hardware_version="V1.1",mac_address="1C:2A:A3:00:12:34",model="SKS3200-8E1X"} 1`,
+		`switch_uptime_seconds 273906`,
+	)
+	// Both families share the page but are fetched once per interval
+	n := 0
+	for _, uri := range sw.Requests() {
+		if uri == "/info.cgi" {
+			n++
+		}
+	}
+	if n != 2 {
+		t.Errorf("got %d requests for the information page, want 2", n)
+	}
+}
+
+func TestInfoLabelsReserved(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", nil)
+	config.Labels = map[string]string{"model": "x"}
+	if err := validateConfig(config); err == nil {
+		t.Error("constant label model accepted")
+	}
+}
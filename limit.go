@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// errSwitchBusy is returned when a request could not get one of the
+// max_switch_requests slots of its switch in time.
+var errSwitchBusy = errors.New("switch busy")
+
+var switchBusy = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "exporter_switch_busy_total",
+	Help: "Number of requests to the switch given up because max_switch_requests were already running",
+}, []string{"switch"})
+
+// switchSlots holds, by switch address, a semaphore bounding the requests
+// running against it. It is shared by scrapes, polls, discovery and the
+// control endpoints, so they queue at the switch rather than overlap.
+var switchSlots = struct {
+	sync.Mutex
+	byAddress map[string]chan struct{}
+}{byAddress: map[string]chan struct{}{}}
+
+// acquireSwitch waits for a free request slot of the switch in config,
+// for at most timeout_seconds or until ctx is done, and returns the
+// function releasing it.
+func acquireSwitch(ctx context.Context, config Config) (func(), error) {
+	switchSlots.Lock()
+	slots := switchSlots.byAddress[config.Address]
+	// A reload changing the limit takes effect for new requests; running
+	// ones release into the semaphore they took
+	if cap(slots) != config.MaxSwitchRequests {
+		slots = make(chan struct{}, config.MaxSwitchRequests)
+		switchSlots.byAddress[config.Address] = slots
+	}
+	switchSlots.Unlock()
+
+	timer := time.NewTimer(time.Duration(config.Timeout) * time.Second)
+	defer timer.Stop()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+	switchBusy.WithLabelValues(config.Address).Inc()
+	return nil, fmt.Errorf("%w: %d requests to %s already running", errSwitchBusy, config.MaxSwitchRequests, config.Address)
+}
+
+// forgetSwitch drops the request slots of address unless requests are
+// running, e.g. for a host discovery gave up on.
+func forgetSwitch(address string) {
+	switchSlots.Lock()
+	defer switchSlots.Unlock()
+	if len(switchSlots.byAddress[address]) == 0 {
+		delete(switchSlots.byAddress, address)
+	}
+}
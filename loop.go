@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LoopStatus is the loop prevention and storm control state of one port.
+// The Has fields record which columns the firmware shows.
+type LoopStatus struct {
+	Port             string
+	LoopDetected     bool
+	HasLoop          bool
+	StormActive      bool
+	HasStorm         bool
+	ErrorDisabled    bool
+	HasErrorDisabled bool
+}
+
+// loopClearStatuses are the cell texts meaning a protection has not
+// triggered. Anything else in a loop or storm column counts as triggered.
+var loopClearStatuses = map[string]bool{
+	"":           true,
+	"-":          true,
+	"no":         true,
+	"none":       true,
+	"normal":     true,
+	"ok":         true,
+	"clear":      true,
+	"off":        true,
+	"disable":    true,
+	"disabled":   true,
+	"forwarding": true,
+	"no loop":    true,
+}
+
+func (c *PortStatsCollector) refreshLoopStatus(ctx context.Context) {
+	ports, err := fetchLoopStatus(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching loop status: %v", err)
+		return
+	}
+	for i := range ports {
+		ports[i].Port = c.truncateLabel(ports[i].Port)
+	}
+	c.loopStatus = ports
+}
+
+func (c *PortStatsCollector) collectLoopStatus(ch chan<- prometheus.Metric) {
+	seen := map[string]bool{}
+	for _, port := range c.loopStatus {
+		if seen[port.Port] {
+			continue
+		}
+		seen[port.Port] = true
+
+		labels := []string{port.Port, c.portRole(port.Port)}
+		if port.HasLoop {
+			ch <- c.constMetric(
+				c.portLoopDetected, prometheus.GaugeValue,
+				boolToFloat(port.LoopDetected), labels...,
+			)
+		}
+		if port.HasStorm {
+			ch <- c.constMetric(
+				c.portStormActive, prometheus.GaugeValue,
+				boolToFloat(port.StormActive), labels...,
+			)
+		}
+		if port.HasErrorDisabled {
+			ch <- c.constMetric(
+				c.portErrorDisabled, prometheus.GaugeValue,
+				boolToFloat(port.ErrorDisabled), labels...,
+			)
+		}
+	}
+}
+
+func fetchLoopStatus(ctx context.Context, config Config) ([]LoopStatus, error) {
+	doc, err := fetchDocument(ctx, config, config.LoopStatusPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseLoopStatus(doc), nil
+}
+
+// parseLoopStatus reads a per-port table whose columns are found by their
+// headers: "loop" for loop detection, "storm" for storm control and
+// "status" or "state" for the resulting port state, where texts like
+// "Error-Disabled", "Shutdown" or "Blocked" mark a port the switch took down
+// itself, as opposed to a port disabled by the administrator.
+func parseLoopStatus(doc *goquery.Document) []LoopStatus {
+	var ports []LoopStatus
+	loopCol, stormCol, statusCol := -1, -1, -1
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		if headers := s.Find("th"); headers.Length() > 0 {
+			headers.Each(func(j int, th *goquery.Selection) {
+				text := strings.ToLower(th.Text())
+				switch {
+				case j == 0:
+				case strings.Contains(text, "loop") && loopCol < 0:
+					loopCol = j
+				case strings.Contains(text, "storm") && stormCol < 0:
+					stormCol = j
+				case (strings.Contains(text, "status") || strings.Contains(text, "state")) && statusCol < 0:
+					statusCol = j
+				}
+			})
+			return
+		}
+
+		cells := s.Find("td")
+		port := LoopStatus{Port: strings.TrimSpace(cells.First().Text())}
+		if port.Port == "" {
+			return
+		}
+		cell := func(col int) (string, bool) {
+			if col < 0 || col >= cells.Length() {
+				return "", false
+			}
+			return strings.ToLower(strings.TrimSpace(cells.Eq(col).Text())), true
+		}
+
+		if text, ok := cell(loopCol); ok {
+			port.LoopDetected, port.HasLoop = !loopClearStatuses[text], true
+		}
+		if text, ok := cell(stormCol); ok {
+			port.StormActive, port.HasStorm = !loopClearStatuses[text], true
+		}
+		if text, ok := cell(statusCol); ok {
+			port.ErrorDisabled = strings.Contains(text, "err") ||
+				strings.Contains(text, "shutdown") ||
+				strings.Contains(text, "block")
+			port.HasErrorDisabled = true
+		}
+		ports = append(ports, port)
+	})
+
+	return ports
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
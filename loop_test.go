@@ -0,0 +1,90 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseLoopStatusTriggered(t *testing.T) {
+	want := []LoopStatus{
+		{Port: "Port 1"},
+		{Port: "Port 2", LoopDetected: true, ErrorDisabled: true},
+		{Port: "Port 3", StormActive: true, ErrorDisabled: true},
+		// Disabled by the administrator, not by loop prevention
+		{Port: "Port 4"},
+	}
+	assertLoopStatus(t, parseLoopStatus(parseFixture(t, "loop_triggered.html")), want)
+}
+
+func TestParseLoopStatusClear(t *testing.T) {
+	want := []LoopStatus{{Port: "Port 1"}, {Port: "Port 2"}, {Port: "Port 3"}, {Port: "Port 4"}}
+	assertLoopStatus(t, parseLoopStatus(parseFixture(t, "loop_clear.html")), want)
+}
+
+// assertLoopStatus compares ports to want, which leaves out the Has fields
+// as every fixture has all three columns.
+func assertLoopStatus(t *testing.T, ports, want []LoopStatus) {
+	t.Helper()
+	if len(ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(ports), len(want), ports)
+	}
+	for i, port := range ports {
+		want[i].HasLoop, want[i].HasStorm, want[i].HasErrorDisabled = true, true, true
+		if port != want[i] {
+			t.Errorf("got %+v, want %+v", port, want[i])
+		}
+	}
+}
+
+func TestLoopStatusMetrics(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/loop.cgi":            readFixture(t, "loop_triggered.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.LoopStatusEnabled = true
+	}))
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_loop_detected{port="Port 1",role="unknown"} 0`,
+		`port_loop_detected{port="Port 2",role="unknown"} 1`,
+		`port_storm_control_active{port="Port 3",role="unknown"} 1`,
+		`port_error_disabled{port="Port 2",role="unknown"} 1`,
+		`port_error_disabled{port="Port 4",role="unknown"} 0`,
+	)
+}
+
+func TestLoopStatusLongPortName(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/loop.cgi": "<table><tr><th>Port</th><th>Loop Status</th></tr>" +
+			"<tr><td>Port 5 behind the printer</td><td>Loop</td></tr></table>",
+	})
+	router, collector := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.LoopStatusEnabled = true
+		c.MaxLabelLength = 6
+	}))
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `port_loop_detected{port="Port 5",role="unknown"} 1`)
+	if v := testutil.ToFloat64(collector.labelsTruncated); v != 1 {
+		t.Errorf("got %v truncated labels, want 1", v)
+	}
+}
+
+func TestLoopStatusInvalidPortName(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/loop.cgi": "<table><tr><th>Port</th><th>Loop Status</th></tr>" +
+			"<tr><td>Port \xff5</td><td>Loop</td></tr></table>",
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.LoopStatusEnabled = true
+	}))
+
+	// Invalid UTF-8 in a label value fails the whole scrape
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `port_loop_detected{port="Port 5",role="unknown"} 1`)
+}
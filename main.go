@@ -1,33 +1,81 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"os"
 	"os/signal"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promauto"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
-	"gopkg.in/yaml.v3"
 )
 
-type Config struct {
-	Address  string `yaml:"address"`
-	Username string `yaml:"username"`
-	Password string `yaml:"password"`
-	PollRate int    `yaml:"poll_rate_seconds"`
-	Timeout  int    `yaml:"timeout_seconds"`
+// switchHTTPResponses counts the status codes returned by the web server of
+// each switch, by address. Requests that fail before a response is received
+// are not counted.
+var switchHTTPResponses = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "switch_http_responses_total",
+	Help: "Number of HTTP responses received from the switch by status code",
+}, []string{"switch", "code"})
+
+// columnMismatches counts stats table rows whose cell count does not fit
+// the configured layout, a sign of changed firmware or a wrong profile.
+var columnMismatches = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "exporter_column_mismatch_total",
+	Help: "Number of stats table rows whose cell count did not match the expected layout",
+})
+
+// maxLoginBackoff caps the pause between logins after the switch rejected
+// the credentials.
+const maxLoginBackoff = 10 * time.Minute
+
+var (
+	// errLoginFailed marks responses showing the switch rejected the
+	// credentials.
+	errLoginFailed = errors.New("login rejected by switch")
+	// errLoginBackoff is returned instead of fetching while logins are
+	// suspended.
+	errLoginBackoff = errors.New("waiting before next login attempt")
+	// errRedirected marks requests the switch redirected where the
+	// exporter does not follow.
+	errRedirected = errors.New("switch redirected")
+	// errTruncated marks HTML pages cut off before their closing tags,
+	// e.g. by a connection reset mid-body.
+	errTruncated = errors.New("page truncated")
+)
+
+// dumpHTML, if set, receives the raw body of every stats page before it is
+// parsed, for attaching to bug reports.
+var dumpHTML io.Writer
+
+// debugLogging enables debugf output.
+var debugLogging bool
+
+func debugf(format string, v ...any) {
+	if debugLogging {
+		log.Printf("DEBUG: "+format, v...)
+	}
 }
 
 type Port struct {
@@ -40,65 +88,523 @@ type Port struct {
 	TxGoodBytes uint64 `json:"tx_good_bytes"`
 }
 
+// UnmarshalJSON accepts state and link_status as either strings or numeric
+// codes, since some firmware reports "state": 1 instead of "Enable". Numbers
+// are kept as their literal text so state_values can map them.
+func (p *Port) UnmarshalJSON(data []byte) error {
+	type plain Port
+	aux := struct {
+		*plain
+		State      json.RawMessage `json:"state"`
+		LinkStatus json.RawMessage `json:"link_status"`
+	}{plain: (*plain)(p)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+
+	var err error
+	if p.State, err = statusText(aux.State); err != nil {
+		return fmt.Errorf("state: %w", err)
+	}
+	if p.LinkStatus, err = statusText(aux.LinkStatus); err != nil {
+		return fmt.Errorf("link_status: %w", err)
+	}
+	return nil
+}
+
+func statusText(raw json.RawMessage) (string, error) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if raw[0] == '"' {
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return strings.TrimSpace(s), err
+	}
+	var n json.Number
+	if err := json.Unmarshal(raw, &n); err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
 type PortStatistics struct {
 	Ports []Port `json:"port_statistics"`
+	// SwitchTime is the clock shown on the stats page, if configured and
+	// found.
+	SwitchTime time.Time `json:"-"`
 }
 
 type PortStatsCollector struct {
-	config             Config
-	portState          *prometheus.Desc
-	portLinkStatus     *prometheus.Desc
-	portTxGoodPkt      *prometheus.Desc
-	portRxGoodPkt      *prometheus.Desc
-	portTxGoodBytes    *prometheus.Desc
-	portRxGoodBytes    *prometheus.Desc
-	lastScrapeDuration prometheus.Gauge
-	scrapeErrorsTotal  prometheus.Counter
-	mutex              sync.Mutex
-}
-
-func NewPortStatsCollector(config Config) *PortStatsCollector {
-	return &PortStatsCollector{
-		config: config,
-		portState: prometheus.NewDesc(
+	config              Config
+	stateValues         map[string]float64
+	linkStatusValues    map[string]float64
+	valueTypes          map[*prometheus.Desc]prometheus.ValueType
+	metricTime          time.Time
+	portState           *prometheus.Desc
+	portLinkStatus      *prometheus.Desc
+	portStateMismatch   *prometheus.Desc
+	portTxGoodPkt       *prometheus.Desc
+	portRxGoodPkt       *prometheus.Desc
+	portTxGoodBytes     *prometheus.Desc
+	portRxGoodBytes     *prometheus.Desc
+	switchInfo          *prometheus.Desc
+	switchUptime        *prometheus.Desc
+	switchTemperature   *prometheus.Desc
+	switchFanRPM        *prometheus.Desc
+	switchCPUUsage      *prometheus.Desc
+	switchMemoryUsage   *prometheus.Desc
+	switchSessions      *prometheus.Desc
+	switchMaxSessions   *prometheus.Desc
+	metricsAge          *prometheus.Desc
+	portConfiguredSpeed *prometheus.Desc
+	portLinkSpeed       *prometheus.Desc
+	portCableLength     *prometheus.Desc
+	portCableFault      *prometheus.Desc
+	portUtilization     *prometheus.Desc
+	portUtilizationEMA  *prometheus.Desc
+	portSaturation      *prometheus.Desc
+	portMTU             *prometheus.Desc
+	switchMaxFrame      *prometheus.Desc
+	portLoopDetected    *prometheus.Desc
+	portStormActive     *prometheus.Desc
+	portErrorDisabled   *prometheus.Desc
+	portOversizeFrames  *prometheus.Desc
+	portUndersizeFrames *prometheus.Desc
+	portFragmentFrames  *prometheus.Desc
+	portJabberFrames    *prometheus.Desc
+	portVLANMembership  *prometheus.Desc
+	portRxBytesSmoothed *prometheus.Desc
+	portTxBytesSmoothed *prometheus.Desc
+	portRxAvgPacketSize *prometheus.Desc
+	portTxAvgPacketSize *prometheus.Desc
+	portLastSeenTime    *prometheus.Desc
+	portPresent         *prometheus.Desc
+	switchUp            *prometheus.Desc
+	switchRebooting     *prometheus.Desc
+	switchTime          *prometheus.Desc
+	switchRedirected    *prometheus.Desc
+	switchTotalRxBytes  *prometheus.Desc
+	switchTotalTxBytes  *prometheus.Desc
+	lastScrapeDuration  prometheus.Gauge
+	scrapeDuration      prometheus.Histogram
+	scrapeErrorsTotal   prometheus.Counter
+	scrapesTotal        *prometheus.CounterVec
+	countersCleared     prometheus.Counter
+	duplicatePorts      prometheus.Counter
+	scrapesInFlight     prometheus.Gauge
+	scrapeQueueWait     prometheus.Histogram
+	activeScrapes       prometheus.Gauge
+	scrapeQueueDepth    prometheus.Gauge
+	loginFailures       prometheus.Counter
+	reauthAttempts      prometheus.Counter
+	trackedPorts        *prometheus.GaugeVec
+	cacheHits           prometheus.Counter
+	cacheMisses         prometheus.Counter
+	labelsTruncated     prometheus.Counter
+	portCountChanged    prometheus.Counter
+	fetcher             StatsFetcher
+	publishers          []StatsPublisher
+	errorLog            *repeatLogger
+	mutex               sync.Mutex
+
+	// The last successfully fetched statistics, served until the poll rate
+	// has elapsed and while the switch cannot be reached.
+	lastStats           PortStatistics
+	lastSuccess         time.Time
+	statsExpired        bool
+	consecutiveFailures int
+
+	// While the switch rejects the credentials, fetches are suspended
+	// until loginRetryAt, doubling loginBackoff after every rejection.
+	loginBackoff time.Duration
+	loginRetryAt time.Time
+
+	// Whether the last fetch was stopped by a redirect.
+	redirected bool
+
+	// Until rebootingUntil the switch is expected to be unreachable after
+	// a reboot through the exporter.
+	rebootingUntil time.Time
+
+	// Byte counters of the previous fetch and the utilization derived
+	// from them.
+	samples          map[string]portSample
+	utilization      map[string]portUtilization
+	utilizationEMA   map[string]portUtilization
+	saturationEvents map[string]float64
+	smoothed         map[string]smoothedBytes
+
+	// Running totals of counters_reset_on_read and counter_width_bits 32,
+	// and the raw counters of the previous fetch the latter unwraps.
+	counterTotals map[string]portCounters
+	counterRaw    map[string]portCounters
+
+	// When each port was last in the fetched statistics.
+	portLastSeen map[string]time.Time
+
+	// Readings from the slow-changing status pages.
+	info            SwitchInfo
+	uptime          *float64
+	environment     Environment
+	systemUsage     SystemUsage
+	sessions        Sessions
+	portSpeeds      map[string]PortSpeed
+	cablePairs      []CablePair
+	frameSizes      FrameSizes
+	loopStatus      []LoopStatus
+	frameErrors     []FrameErrors
+	vlans           []VLANMembership
+	familyFetchedAt map[string]time.Time
+
+	// The outcome of the last fetch for /targets, readable while a scrape
+	// holds mutex.
+	status atomic.Pointer[targetStatus]
+}
+
+// portLabels are the variable labels of every per-port metric.
+var portLabels = []string{"port", "role"}
+
+// NewPortStatsCollector creates a collector for the switch in config. Its
+// self-metrics are registered with reg. The labels from config are added to
+// every metric.
+func NewPortStatsCollector(config Config, reg prometheus.Registerer) *PortStatsCollector {
+	if config.MinimalMetrics {
+		// Self-metrics are still maintained but never gathered
+		reg = prometheus.NewRegistry()
+	}
+	labels := prometheus.Labels(config.Labels)
+	factory := promauto.With(prometheus.WrapRegistererWith(labels, reg))
+
+	// Switch metrics are described through newDesc so metric_overrides
+	// can rename them, change their help and their type.
+	valueTypes := map[*prometheus.Desc]prometheus.ValueType{}
+	described := map[string]bool{}
+	newDesc := func(name, help string, variableLabels []string) *prometheus.Desc {
+		described[name] = true
+		override := config.MetricOverrides[name]
+		if override.Name != "" {
+			name = override.Name
+		}
+		if override.Help != "" {
+			help = override.Help
+		}
+		desc := prometheus.NewDesc(name, help, variableLabels, labels)
+		if vt, ok := metricValueTypes[override.Type]; ok {
+			valueTypes[desc] = vt
+		}
+		return desc
+	}
+
+	c := &PortStatsCollector{
+		config:           config,
+		valueTypes:       valueTypes,
+		fetcher:          configFetcher{config},
+		errorLog:         &repeatLogger{interval: time.Duration(config.LogRepeatInterval) * time.Second},
+		stateValues:      mergeValues(DefaultStateValues, config.StateValues),
+		linkStatusValues: mergeValues(DefaultLinkStatusValues, config.LinkStatusValues),
+		portState: newDesc(
 			"port_state",
 			"State of the port",
-			[]string{"port"}, nil,
+			portLabels,
 		),
-		portLinkStatus: prometheus.NewDesc(
+		portLinkStatus: newDesc(
 			"port_link_status",
 			"Link status of the port",
-			[]string{"port"}, nil,
+			portLabels,
+		),
+		portStateMismatch: newDesc(
+			"port_state_mismatch",
+			"Whether the port is enabled but its link is down",
+			portLabels,
 		),
-		portTxGoodPkt: prometheus.NewDesc(
+		portTxGoodPkt: newDesc(
 			"port_tx_good_pkt",
 			"Number of good packets transmitted on the port",
-			[]string{"port"}, nil,
+			portLabels,
 		),
-		portRxGoodPkt: prometheus.NewDesc(
+		portRxGoodPkt: newDesc(
 			"port_rx_good_pkt",
 			"Number of good packets received on the port",
-			[]string{"port"}, nil,
+			portLabels,
 		),
-		portTxGoodBytes: prometheus.NewDesc(
+		portTxGoodBytes: newDesc(
 			"port_tx_good_bytes",
 			"Number of good bytes transmitted on the port",
-			[]string{"port"}, nil,
+			portLabels,
 		),
-		portRxGoodBytes: prometheus.NewDesc(
+		portRxGoodBytes: newDesc(
 			"port_rx_good_bytes",
 			"Number of good bytes received on the port",
-			[]string{"port"}, nil,
+			portLabels,
+		),
+		switchInfo: newDesc(
+			"switch_info",
+			"Identity of the switch from its system information page, always 1",
+			infoLabels,
+		),
+		switchUptime: newDesc(
+			"switch_uptime_seconds",
+			"Time since the switch booted",
+			nil,
+		),
+		switchTemperature: newDesc(
+			"switch_temperature_celsius",
+			"Chassis temperature reported by the switch",
+			nil,
+		),
+		switchFanRPM: newDesc(
+			"switch_fan_rpm",
+			"Fan speed reported by the switch",
+			[]string{"fan"},
+		),
+		switchCPUUsage: newDesc(
+			"switch_cpu_usage_ratio",
+			"CPU utilization reported by the switch (0-1)",
+			nil,
+		),
+		switchMemoryUsage: newDesc(
+			"switch_memory_usage_ratio",
+			"Memory utilization reported by the switch (0-1)",
+			nil,
+		),
+		switchSessions: newDesc(
+			"switch_active_sessions",
+			"Web interface sessions in use on the switch",
+			nil,
+		),
+		switchMaxSessions: newDesc(
+			"switch_max_sessions",
+			"Web interface sessions the switch allows at once",
+			nil,
+		),
+		portConfiguredSpeed: newDesc(
+			"port_configured_speed",
+			"Administratively configured port speed in Mbps, 0 for auto-negotiation",
+			portLabels,
+		),
+		portLinkSpeed: newDesc(
+			"port_link_speed_mbps",
+			"Negotiated port speed in Mbps, 0 when the link is down",
+			portLabels,
+		),
+		portCableLength: newDesc(
+			"port_cable_length_meters",
+			"Estimated cable length per pair from the last cable test",
+			[]string{"port", "role", "pair"},
+		),
+		portCableFault: newDesc(
+			"port_cable_fault",
+			"Whether the last cable test found a fault on the pair (1) or not (0)",
+			[]string{"port", "role", "pair", "status"},
 		),
-		lastScrapeDuration: promauto.NewGauge(prometheus.GaugeOpts{
+		portUtilization: newDesc(
+			"port_bandwidth_utilization_ratio",
+			"Share of the link speed used between the last two fetches (0-1)",
+			[]string{"port", "role", "direction"},
+		),
+		portUtilizationEMA: newDesc(
+			"port_bandwidth_utilization_ema",
+			"Exponential moving average of port_bandwidth_utilization_ratio (0-1)",
+			[]string{"port", "role", "direction"},
+		),
+		portSaturation: newDesc(
+			"port_saturation_events_total",
+			"Number of fetches where the port utilization exceeded saturation_threshold",
+			portLabels,
+		),
+		portMTU: newDesc(
+			"port_mtu_bytes",
+			"Configured maximum frame size of the port in bytes",
+			portLabels,
+		),
+		switchMaxFrame: newDesc(
+			"switch_max_frame_bytes",
+			"Configured switch-wide maximum frame size in bytes",
+			nil,
+		),
+		portLoopDetected: newDesc(
+			"port_loop_detected",
+			"Whether loop prevention has detected a loop on the port",
+			portLabels,
+		),
+		portStormActive: newDesc(
+			"port_storm_control_active",
+			"Whether storm control is currently limiting traffic on the port",
+			portLabels,
+		),
+		portErrorDisabled: newDesc(
+			"port_error_disabled",
+			"Whether the switch has shut the port down because of a loop or storm",
+			portLabels,
+		),
+		portOversizeFrames: newDesc(
+			"port_oversize_frames_total",
+			"Received frames longer than the maximum frame size with a valid CRC",
+			portLabels,
+		),
+		portUndersizeFrames: newDesc(
+			"port_undersize_frames_total",
+			"Received frames shorter than 64 bytes with a valid CRC",
+			portLabels,
+		),
+		portFragmentFrames: newDesc(
+			"port_fragment_frames_total",
+			"Received frames shorter than 64 bytes with a bad CRC",
+			portLabels,
+		),
+		portJabberFrames: newDesc(
+			"port_jabber_frames_total",
+			"Received frames longer than the maximum frame size with a bad CRC",
+			portLabels,
+		),
+		portVLANMembership: newDesc(
+			"port_vlan_membership",
+			"VLAN membership of the port, 1 per VLAN and membership mode",
+			[]string{"port", "role", "vlan", "mode"},
+		),
+		portRxBytesSmoothed: newDesc(
+			"port_rx_good_bytes_smoothed",
+			"Received good bytes, smoothed as an exponential moving average over fetches",
+			portLabels,
+		),
+		portTxBytesSmoothed: newDesc(
+			"port_tx_good_bytes_smoothed",
+			"Transmitted good bytes, smoothed as an exponential moving average over fetches",
+			portLabels,
+		),
+		portRxAvgPacketSize: newDesc(
+			"port_rx_avg_packet_size_bytes",
+			"Average size of the good packets received on the port since its counters were cleared",
+			portLabels,
+		),
+		portTxAvgPacketSize: newDesc(
+			"port_tx_avg_packet_size_bytes",
+			"Average size of the good packets transmitted on the port since its counters were cleared",
+			portLabels,
+		),
+		portLastSeenTime: newDesc(
+			"port_last_seen_timestamp_seconds",
+			"When the port was last reported by the switch",
+			portLabels,
+		),
+		portPresent: newDesc(
+			"port_present",
+			"Whether the port is in the current statistics; 0 during port_absent_grace_seconds after it vanished",
+			portLabels,
+		),
+		switchUp: newDesc(
+			"switch_up",
+			"Whether the last fetch of the port statistics succeeded",
+			nil,
+		),
+		switchRebooting: newDesc(
+			"exporter_switch_rebooting",
+			"Whether the switch is within the grace period of a reboot issued through the exporter",
+			nil,
+		),
+		switchRedirected: newDesc(
+			"switch_redirect_detected",
+			"Whether the last fetch was redirected by the switch, usually to its login page",
+			nil,
+		),
+		switchTotalRxBytes: newDesc(
+			"switch_total_rx_bytes_total",
+			"Good bytes received summed over all ports",
+			nil,
+		),
+		switchTotalTxBytes: newDesc(
+			"switch_total_tx_bytes_total",
+			"Good bytes transmitted summed over all ports",
+			nil,
+		),
+		switchTime: newDesc(
+			"switch_time_seconds",
+			"Clock of the switch as shown on the stats page, in Unix time",
+			nil,
+		),
+		metricsAge: newDesc(
+			"exporter_metrics_age_seconds",
+			"Age of the served port metrics, growing while scrapes fail",
+			nil,
+		),
+		lastScrapeDuration: factory.NewGauge(prometheus.GaugeOpts{
 			Name: "exporter_last_scrape_duration_seconds",
 			Help: "Duration of the last scrape",
 		}),
-		scrapeErrorsTotal: promauto.NewCounter(prometheus.CounterOpts{
+		scrapeDuration: factory.NewHistogram(prometheus.HistogramOpts{
+			Name: "exporter_scrape_duration_seconds",
+			Help: "Duration of scrapes, with the switch address as exemplar",
+		}),
+		scrapeErrorsTotal: factory.NewCounter(prometheus.CounterOpts{
 			Name: "exporter_scrape_errors_total",
 			Help: "Total number of scrape errors",
 		}),
+		scrapesTotal: factory.NewCounterVec(prometheus.CounterOpts{
+			Name: "exporter_scrapes_total",
+			Help: "Number of port statistics fetches from the switch by result",
+		}, []string{"switch", "result"}),
+		countersCleared: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_counters_cleared_total",
+			Help: "Number of deliberate port counter clears issued through the exporter",
+		}),
+		duplicatePorts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_duplicate_ports_total",
+			Help: "Number of parsed ports dropped because their name was already seen in the same scrape",
+		}),
+		scrapesInFlight: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_scrapes_in_flight",
+			Help: "Number of scrapes currently running or waiting for another scrape",
+		}),
+		scrapeQueueWait: factory.NewHistogram(prometheus.HistogramOpts{
+			Name: "exporter_scrape_queue_wait_seconds",
+			Help: "Time scrapes spent waiting for a concurrent scrape to finish",
+		}),
+		activeScrapes: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_active_scrapes",
+			Help: "Number of scrapes and polls currently fetching from the switch",
+		}),
+		scrapeQueueDepth: factory.NewGauge(prometheus.GaugeOpts{
+			Name: "exporter_scrape_queue_depth",
+			Help: "Number of scrapes and polls waiting for another one to finish",
+		}),
+		portCountChanged: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_port_count_changed_total",
+			Help: "Number of fetches whose port count differed from the previous successful fetch",
+		}),
+		labelsTruncated: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_labels_truncated_total",
+			Help: "Number of parsed port names cut to max_label_length",
+		}),
+		loginFailures: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_login_failures_total",
+			Help: "Number of fetches rejected by the switch because of wrong credentials",
+		}),
+		reauthAttempts: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_reauth_attempts_total",
+			Help: "Number of fetches retried with a new login after the switch rejected the first",
+		}),
+		cacheHits: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_cache_hits_total",
+			Help: "Number of requests for the port statistics served from the cache",
+		}),
+		cacheMisses: factory.NewCounter(prometheus.CounterOpts{
+			Name: "exporter_cache_misses_total",
+			Help: "Number of requests for the port statistics that fetched them from the switch",
+		}),
+		trackedPorts: factory.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "exporter_tracked_ports",
+			Help: "Number of ports held in each per-port map of the collector",
+		}, []string{"map"}),
+	}
+
+	for name := range config.MetricOverrides {
+		if !described[name] {
+			log.Printf("Ignoring metric_overrides for unknown metric %q", name)
+		}
 	}
+	c.storeStatus("unknown", nil)
+	return c
 }
 
 func (c *PortStatsCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -108,81 +614,602 @@ func (c *PortStatsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.portRxGoodPkt
 	ch <- c.portTxGoodBytes
 	ch <- c.portRxGoodBytes
+	ch <- c.switchInfo
+	ch <- c.switchUptime
+	ch <- c.switchTemperature
+	ch <- c.switchFanRPM
+	ch <- c.switchCPUUsage
+	ch <- c.switchMemoryUsage
+	ch <- c.switchSessions
+	ch <- c.switchMaxSessions
+	ch <- c.portConfiguredSpeed
+	ch <- c.portLinkSpeed
+	ch <- c.portCableLength
+	ch <- c.portCableFault
+	ch <- c.portUtilization
+	ch <- c.portUtilizationEMA
+	ch <- c.portSaturation
+	ch <- c.portMTU
+	ch <- c.switchMaxFrame
+	ch <- c.portLoopDetected
+	ch <- c.portStormActive
+	ch <- c.portErrorDisabled
+	ch <- c.portOversizeFrames
+	ch <- c.portUndersizeFrames
+	ch <- c.portFragmentFrames
+	ch <- c.portJabberFrames
+	ch <- c.portVLANMembership
+	ch <- c.portRxBytesSmoothed
+	ch <- c.portTxBytesSmoothed
+	ch <- c.portRxAvgPacketSize
+	ch <- c.portTxAvgPacketSize
+	ch <- c.portLastSeenTime
+	ch <- c.portPresent
+	ch <- c.switchUp
+	ch <- c.switchRebooting
+	ch <- c.switchTime
+	ch <- c.switchRedirected
+	ch <- c.switchTotalRxBytes
+	ch <- c.switchTotalTxBytes
+	ch <- c.metricsAge
 }
 
 func (c *PortStatsCollector) Collect(ch chan<- prometheus.Metric) {
-	c.mutex.Lock()
-	defer c.mutex.Unlock()
+	c.collect(context.Background(), ch)
+}
+
+// collect gathers the metrics, giving up on requests to the switch once ctx
+// is done.
+func (c *PortStatsCollector) collect(ctx context.Context, ch chan<- prometheus.Metric) {
+	// Unexpected firmware output must not take down the HTTP handler
+	defer func() {
+		if r := recover(); r != nil {
+			c.scrapeErrorsTotal.Inc()
+			log.Printf("Recovered from panic during scrape: %v", r)
+		}
+	}()
+
+	c.scrapesInFlight.Inc()
+	defer c.scrapesInFlight.Dec()
+
+	queued := time.Now()
+	c.lockScrape()
+	defer c.unlockScrape()
+	c.scrapeQueueWait.Observe(time.Since(queued).Seconds())
 
 	start := time.Now()
-	stats, err := fetchPortStatistics(c.config)
-	if err != nil {
-		c.scrapeErrorsTotal.Inc()
-		log.Printf("Error fetching port statistics: %v", err)
+	stats, age, ok := c.portStatistics(ctx)
+	// After the stats, so a rejected login suspends the status pages too and
+	// the VLAN page resolves port numbers against fresh port names
+	c.collectStatusFamilies(ctx, ch)
+
+	ch <- c.constMetric(
+		c.switchUp, prometheus.GaugeValue, c.up(),
+	)
+	ch <- c.constMetric(
+		c.switchRebooting, prometheus.GaugeValue,
+		boolToFloat(time.Now().Before(c.rebootingUntil)),
+	)
+	ch <- c.constMetric(
+		c.switchRedirected, prometheus.GaugeValue, boolToFloat(c.redirected),
+	)
+	if !ok {
 		return
 	}
 
+	if !c.config.MinimalMetrics {
+		ch <- c.constMetric(
+			c.metricsAge, prometheus.GaugeValue, age.Seconds(),
+		)
+	}
+
+	c.collectSwitchTime(ch, stats, age)
+
+	// The port metrics carry the time the switch measured them
+	if c.config.SwitchTimestamps {
+		c.metricTime = stats.SwitchTime
+		defer func() { c.metricTime = time.Time{} }()
+	}
+
+	seen := make(map[string]bool, len(stats.Ports))
+	var totalRxBytes, totalTxBytes uint64
 	for _, port := range stats.Ports {
-		ch <- prometheus.MustNewConstMetric(
+		// A repeated name would make the registry reject the whole scrape
+		if seen[port.Name] {
+			c.duplicatePorts.Inc()
+			debugf("Skipping duplicate port %q", port.Name)
+			continue
+		}
+		seen[port.Name] = true
+		totalRxBytes += port.RxGoodBytes
+		totalTxBytes += port.TxGoodBytes
+
+		labels := []string{port.Name, c.portRole(port.Name)}
+		ch <- c.constMetric(
 			c.portState, prometheus.GaugeValue,
-			stateToFloat(port.State), port.Name,
+			c.stateToFloat(port.State), labels...,
 		)
-		ch <- prometheus.MustNewConstMetric(
+		ch <- c.constMetric(
 			c.portLinkStatus, prometheus.GaugeValue,
-			linkStatusToFloat(port.LinkStatus), port.Name,
+			c.linkStatusToFloat(port.LinkStatus), labels...,
 		)
-		ch <- prometheus.MustNewConstMetric(
+		if c.config.StateMismatchEnabled {
+			ch <- c.constMetric(
+				c.portStateMismatch, prometheus.GaugeValue,
+				boolToFloat(c.stateMismatch(port)), labels...,
+			)
+		}
+		ch <- c.constMetric(
 			c.portTxGoodPkt, prometheus.CounterValue,
-			float64(port.TxGoodPkt), port.Name,
+			float64(port.TxGoodPkt), labels...,
 		)
-		ch <- prometheus.MustNewConstMetric(
+		ch <- c.constMetric(
 			c.portRxGoodPkt, prometheus.CounterValue,
-			float64(port.RxGoodPkt), port.Name,
+			float64(port.RxGoodPkt), labels...,
 		)
-		ch <- prometheus.MustNewConstMetric(
+		ch <- c.constMetric(
 			c.portTxGoodBytes, prometheus.CounterValue,
-			float64(port.TxGoodBytes), port.Name,
+			float64(port.TxGoodBytes), labels...,
 		)
-		ch <- prometheus.MustNewConstMetric(
+		ch <- c.constMetric(
 			c.portRxGoodBytes, prometheus.CounterValue,
-			float64(port.RxGoodBytes), port.Name,
+			float64(port.RxGoodBytes), labels...,
+		)
+		c.collectUtilization(ch, port.Name, labels)
+		c.collectSmoothing(ch, port.Name, labels)
+		c.collectPacketSize(ch, port, labels)
+	}
+	c.collectPresence(ch, stats)
+
+	if len(seen) > 0 {
+		ch <- c.constMetric(
+			c.switchTotalRxBytes, prometheus.CounterValue, float64(totalRxBytes),
+		)
+		ch <- c.constMetric(
+			c.switchTotalTxBytes, prometheus.CounterValue, float64(totalTxBytes),
 		)
 	}
 
 	duration := time.Since(start).Seconds()
 	c.lastScrapeDuration.Set(duration)
+	// Exemplars are only exposed to clients negotiating OpenMetrics
+	c.scrapeDuration.(prometheus.ExemplarObserver).ObserveWithExemplar(
+		duration, prometheus.Labels{"switch": c.config.Address},
+	)
+}
+
+// lockScrape takes the collector lock for a fetch from the switch, tracking
+// it as queued until the lock is held and as active until unlockScrape.
+func (c *PortStatsCollector) lockScrape() {
+	c.scrapeQueueDepth.Inc()
+	c.mutex.Lock()
+	c.scrapeQueueDepth.Dec()
+	c.activeScrapes.Inc()
+}
+
+func (c *PortStatsCollector) unlockScrape() {
+	c.activeScrapes.Dec()
+	c.mutex.Unlock()
+}
+
+// constMetric is prometheus.MustNewConstMetric with the type set in
+// metric_overrides, if any, and the timestamp in metricTime, if set.
+func (c *PortStatsCollector) constMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) prometheus.Metric {
+	if override, ok := c.valueTypes[desc]; ok {
+		valueType = override
+	}
+	metric := prometheus.MustNewConstMetric(desc, valueType, value, labels...)
+	if !c.metricTime.IsZero() {
+		metric = prometheus.NewMetricWithTimestamp(c.metricTime, metric)
+	}
+	return metric
+}
+
+// portStatistics returns the cached statistics while they are younger than
+// the poll rate and fetches them from the switch otherwise. If the fetch
+// fails, the last good statistics are served along with their age until
+// MaxConsecutiveFailures fetches in a row have failed.
+func (c *PortStatsCollector) portStatistics(ctx context.Context) (PortStatistics, time.Duration, bool) {
+	pollRate := time.Duration(c.config.PollRate) * time.Second
+	if !c.lastSuccess.IsZero() && !c.statsExpired {
+		if age := time.Since(c.lastSuccess); age < pollRate {
+			c.cacheHits.Inc()
+			return c.lastStats, age, true
+		}
+	}
+
+	var stats PortStatistics
+	var err error
+	if time.Now().Before(c.loginRetryAt) {
+		err = errLoginBackoff
+	} else {
+		c.cacheMisses.Inc()
+		stats, err = c.fetch(ctx)
+		// An expired session also answers with the login page; the
+		// retry sends the credentials again and tells it apart from
+		// wrong ones
+		if errors.Is(err, errLoginFailed) && c.config.ReauthOnFailure {
+			c.reauthAttempts.Inc()
+			debugf("Login to %s rejected, logging in again: %v", c.config.Address, err)
+			stats, err = c.fetch(ctx)
+		}
+	}
+	if err != nil && !errors.Is(err, errLoginBackoff) {
+		c.scrapesTotal.WithLabelValues(c.config.Address, scrapeResult(err)).Inc()
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, errLoginBackoff):
+			// Neither an attempt nor worth a log line
+		case errors.Is(err, errSwitchBusy):
+			// The switch is fine, only its request slots were taken
+			debugf("Skipping fetch of port statistics: %v", err)
+		case errors.Is(err, errLoginFailed):
+			c.scrapeErrorsTotal.Inc()
+			c.consecutiveFailures++
+			c.loginFailed(err)
+		case time.Now().Before(c.rebootingUntil):
+			c.scrapeErrorsTotal.Inc()
+			c.consecutiveFailures++
+			debugf("Error fetching port statistics while the switch reboots: %v", err)
+		default:
+			c.scrapeErrorsTotal.Inc()
+			c.consecutiveFailures++
+			c.errorLog.Printf("Error fetching port statistics: %v", err)
+		}
+		if !errors.Is(err, errLoginBackoff) {
+			c.storeStatus(scrapeResult(err), err)
+		}
+		if c.lastSuccess.IsZero() || c.consecutiveFailures >= c.config.MaxConsecutiveFailures {
+			return PortStatistics{}, 0, false
+		}
+		return c.lastStats, time.Since(c.lastSuccess), true
+	}
+
+	if c.loginBackoff > 0 {
+		log.Printf("Login to switch %s succeeded again", c.config.Address)
+		c.loginBackoff = 0
+		c.loginRetryAt = time.Time{}
+	}
+
+	c.scrapesTotal.WithLabelValues(c.config.Address, "success").Inc()
+	for i := range stats.Ports {
+		stats.Ports[i].Name = c.truncateLabel(stats.Ports[i].Name)
+	}
+	if c.config.CountersResetOnRead {
+		stats = c.accumulateCounters(stats)
+	}
+	if c.config.CounterWidthBits == 32 {
+		stats = c.unwrapCounters(stats, time.Now())
+	}
+	// A changed port count more often means a parser problem than new ports
+	if !c.lastSuccess.IsZero() && len(stats.Ports) != len(c.lastStats.Ports) {
+		c.portCountChanged.Inc()
+		log.Printf("Port count changed from %d to %d", len(c.lastStats.Ports), len(stats.Ports))
+	}
+	c.lastStats = stats
+	c.lastSuccess = time.Now()
+	c.updateUtilization(stats, c.lastSuccess)
+	c.updatePresence(stats, c.lastSuccess)
+	c.updateSmoothing(stats)
+	c.evictPorts(c.lastSuccess)
+	c.statsExpired = false
+	c.consecutiveFailures = 0
+	c.storeStatus("success", nil)
+	c.errorLog.Flush()
+	for _, p := range c.publishers {
+		p.Publish(stats)
+	}
+	return stats, 0, true
+}
+
+// scrapeResult is the result label of a failed fetch.
+func scrapeResult(err error) string {
+	if errors.Is(err, errSwitchBusy) {
+		return "busy"
+	}
+	return "error"
+}
+
+// truncateLabel cuts value to MaxLabelLength bytes without splitting a
+// UTF-8 sequence. Invalid UTF-8, which would make the label value
+// unexportable, is dropped either way.
+func (c *PortStatsCollector) truncateLabel(value string) string {
+	if len(value) <= c.config.MaxLabelLength {
+		return strings.ToValidUTF8(value, "")
+	}
+	c.labelsTruncated.Inc()
+	debugf("Truncating label value %q", value)
+	return strings.ToValidUTF8(value[:c.config.MaxLabelLength], "")
+}
+
+// truncateKeys returns m with its port name keys passed through
+// truncateLabel.
+func truncateKeys[V any](c *PortStatsCollector, m map[string]V) map[string]V {
+	if m == nil {
+		return nil
+	}
+	truncated := make(map[string]V, len(m))
+	for name, value := range m {
+		truncated[c.truncateLabel(name)] = value
+	}
+	return truncated
+}
+
+// fetch fetches the port statistics once.
+func (c *PortStatsCollector) fetch(ctx context.Context) (PortStatistics, error) {
+	stats, err := c.fetcher.FetchPortStatistics(ctx)
+	c.redirected = errors.Is(err, errRedirected)
+	// No real switch has that many ports, the page was misparsed
+	if err == nil && len(stats.Ports) > c.config.MaxPorts {
+		err = fmt.Errorf("parsed %d ports, more than max_ports %d", len(stats.Ports), c.config.MaxPorts)
+	}
+	return stats, err
+}
+
+// loginFailed suspends fetching for a jittered, exponentially growing
+// interval so wrong credentials do not hammer the switch, logging only the
+// first rejection.
+func (c *PortStatsCollector) loginFailed(err error) {
+	c.loginFailures.Inc()
+	if c.loginBackoff == 0 {
+		log.Printf("Error fetching port statistics: %v; check the credentials", err)
+		c.loginBackoff = time.Duration(c.config.PollRate) * time.Second
+	} else {
+		c.loginBackoff = min(2*c.loginBackoff, maxLoginBackoff)
+	}
+	// Up to 20% jitter keeps several exporters from retrying in lockstep
+	jitter := time.Duration(rand.Int63n(int64(c.loginBackoff)/5 + 1))
+	c.loginRetryAt = time.Now().Add(c.loginBackoff + jitter)
+	debugf("Retrying login to %s in %s", c.config.Address, c.loginBackoff+jitter)
+}
+
+func (c *PortStatsCollector) up() float64 {
+	if c.lastSuccess.IsZero() || c.consecutiveFailures > 0 {
+		return 0
+	}
+	return 1
+}
+
+// Poll refreshes the port statistics every poll interval until ctx is done,
+// so publishers receive updates even when nothing scrapes the exporter.
+func (c *PortStatsCollector) Poll(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(c.config.PollRate) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		c.lockScrape()
+		c.portStatistics(ctx)
+		c.unlockScrape()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SetFetcher replaces the source of the port statistics, e.g. with a fake
+// in tests. It is kept across reloads.
+func (c *PortStatsCollector) SetFetcher(f StatsFetcher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.fetcher = f
+}
+
+// AddPublisher registers an output that receives every fresh set of port
+// statistics.
+func (c *PortStatsCollector) AddPublisher(p StatsPublisher) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.publishers = append(c.publishers, p)
+}
+
+// StatusPagesChanged makes the next scrape refetch the status pages instead
+// of serving cached readings.
+func (c *PortStatsCollector) StatusPagesChanged() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.familyFetchedAt = nil
+}
+
+// CountersCleared records a deliberate clear of the switch counters, so the
+// drop seen on the next scrape is not mistaken for a counter reset.
+func (c *PortStatsCollector) CountersCleared() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.countersCleared.Inc()
+	c.statsExpired = true
+	// The drop to zero is not traffic; start over from the next sample
+	c.samples = nil
+	c.counterRaw = nil
+}
+
+// Rebooting records a reboot issued through the exporter. Failed fetches
+// are expected for the grace period, and the counters start over.
+func (c *PortStatsCollector) Rebooting() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.rebootingUntil = time.Now().Add(time.Duration(c.config.RebootGrace) * time.Second)
+	c.statsExpired = true
+	c.samples = nil
+	c.counterRaw = nil
+	c.familyFetchedAt = nil
+}
+
+// Config returns the configuration the collector currently runs with.
+func (c *PortStatsCollector) Config() Config {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.config
+}
+
+// Reload switches the collector to config. Cached data is dropped since
+// it may come from another switch or with other credentials. Outputs and
+// the poll interval of background polling keep their startup settings.
+func (c *PortStatsCollector) Reload(config Config) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.config = config
+	if _, ok := c.fetcher.(configFetcher); ok {
+		c.fetcher = configFetcher{config}
+	}
+	c.stateValues = mergeValues(DefaultStateValues, config.StateValues)
+	c.linkStatusValues = mergeValues(DefaultLinkStatusValues, config.LinkStatusValues)
+	c.lastStats = PortStatistics{}
+	c.lastSuccess = time.Time{}
+	c.consecutiveFailures = 0
+	c.errorLog.Flush()
+	c.errorLog.interval = time.Duration(config.LogRepeatInterval) * time.Second
+	c.loginBackoff = 0
+	c.loginRetryAt = time.Time{}
+	c.redirected = false
+	c.samples = nil
+	c.utilization = nil
+	c.utilizationEMA = nil
+	c.saturationEvents = nil
+	c.smoothed = nil
+	c.counterTotals = nil
+	c.counterRaw = nil
+	c.portLastSeen = nil
+	c.info = SwitchInfo{}
+	c.uptime = nil
+	c.environment = Environment{}
+	c.systemUsage = SystemUsage{}
+	c.sessions = Sessions{}
+	c.portSpeeds = nil
+	c.cablePairs = nil
+	c.frameSizes = FrameSizes{}
+	c.loopStatus = nil
+	c.frameErrors = nil
+	c.vlans = nil
+	c.familyFetchedAt = nil
+	c.storeStatus("unknown", nil)
 }
 
 func main() {
+	configFile := flag.String("config.file", "", "Path to the configuration file or directory, - for stdin (default: first of "+strings.Join(defaultConfigFiles, ", ")+" that exists)")
+	envFile := flag.String("env.file", "", "Path to a .env file whose values override the YAML configuration")
+	flag.BoolVar(&debugLogging, "log.debug", false, "Enable debug logging")
+	listenAddresses := flag.String("web.listen-address", ":8080", "Comma-separated addresses to listen on for the web interface and telemetry")
+	telemetryPath := flag.String("web.telemetry-path", "/metrics", "Path under which to expose metrics")
+	oneshot := flag.Bool("oneshot", false, "Scrape the switch once, print the metrics to stdout and exit")
+	dumpHTMLPath := flag.String("dump-html", "", "With -oneshot, write the raw stats page from the switch to this file")
+	flag.Parse()
+
 	// Read configuration
-	config, err := readConfig("config.yaml")
+	if *configFile == "" {
+		*configFile = findConfigFile()
+	}
+	config, err := loadConfig(*configFile, *envFile)
 	if err != nil {
-		log.Fatalf("Error reading configuration: %v", err)
+		log.Fatal(err)
+	}
+	// The initial load counts as the first successful reload
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.SetToCurrentTime()
+
+	// Open the SSH tunnel up front so a bad key or known hosts file fails
+	// at startup rather than on the first scrape
+	if config.SSHHost != "" {
+		if _, err := openSSHTunnel(config); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Create custom collector
+	// The collector itself is registered per request by metricsHandler
+	collector := NewPortStatsCollector(config, prometheus.DefaultRegisterer)
+
+	if *oneshot {
+		var dumpFile *os.File
+		if *dumpHTMLPath != "" {
+			if dumpFile, err = os.Create(*dumpHTMLPath); err != nil {
+				log.Fatal(err)
+			}
+			dumpHTML = dumpFile
+		}
+		code := runOneshot(collector)
+		if dumpFile != nil {
+			if err := dumpFile.Close(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		os.Exit(code)
+	}
+	if *dumpHTMLPath != "" {
+		log.Fatal("-dump-html requires -oneshot")
+	}
+
+	// Stagger the first contact with the switch across exporters started
+	// at the same time
+	if delay := startupDelay(config); delay > 0 {
+		log.Printf("Waiting %s before starting", delay)
+		time.Sleep(delay)
 	}
 
-	// Set default values if not specified
-	if config.PollRate == 0 {
-		config.PollRate = 10 // Default 10 seconds
+	if config.MQTTBroker != "" {
+		publisher := NewMQTTPublisher(config)
+		defer publisher.Close()
+		collector.AddPublisher(publisher)
 	}
-	if config.Timeout == 0 {
-		config.Timeout = 5 // Default 5 seconds
+	if config.GraphiteAddress != "" {
+		collector.AddPublisher(NewGraphitePublisher(config, prometheus.DefaultRegisterer))
 	}
+	if config.WebhookURL != "" {
+		collector.AddPublisher(NewWebhookPublisher(config, prometheus.DefaultRegisterer))
+	}
+	// Cancelled on shutdown to stop background work
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	// Validate configuration
-	if config.Address == "" || config.Username == "" || config.Password == "" {
-		log.Fatal("Missing required configuration fields")
+	if config.StateFile != "" {
+		collector.LoadState()
+		go collector.PersistState(ctx)
 	}
 
-	// Create custom collector
-	collector := NewPortStatsCollector(config)
-	prometheus.MustRegister(collector)
+	// Push outputs must not depend on Prometheus scraping
+	if config.MQTTBroker != "" || config.GraphiteAddress != "" || config.WebhookURL != "" {
+		go collector.Poll(ctx)
+	}
+
+	var discovered *discovery
+	if config.DiscoveryEnabled {
+		discovered = newDiscovery(config)
+		go discovered.Run(ctx)
+	}
 
 	// Start Prometheus HTTP server
-	http.Handle("/metrics", promhttp.Handler())
+	handler := &swapHandler{}
+	reload := &reloader{
+		configFile:    *configFile,
+		envFile:       *envFile,
+		telemetryPath: *telemetryPath,
+		collector:     collector,
+		discovered:    discovered,
+		handler:       handler,
+		config:        config,
+	}
+	handler.Store(newRouter(config, reload))
+	listeners, err := listenAll(*listenAddresses)
+	if err != nil {
+		log.Fatalf("Error listening on -web.listen-address: %v", err)
+	}
+	servers := serveAll(listeners, config, handler, *telemetryPath)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
 	go func() {
-		log.Println("Starting Prometheus exporter on :8080/metrics")
-		if err := http.ListenAndServe(":8080", nil); err != nil {
-			log.Fatalf("HTTP server error: %v", err)
+		for range hup {
+			reload.Reload()
 		}
 	}()
 
@@ -192,71 +1219,519 @@ func main() {
 
 	<-stop
 	log.Println("Shutting down...")
+	cancel()
+
+	// Let in-flight scrapes finish, but never hang on a stuck switch
+	timeout := time.Duration(config.ShutdownTimeout) * time.Second
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), timeout)
+	defer shutdownCancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- shutdownAll(shutdownCtx, servers)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			log.Printf("Shutdown timed out after %s, forcing exit: %v", timeout, err)
+			os.Exit(1)
+		}
+		if config.StateFile != "" {
+			if err := collector.SaveState(); err != nil {
+				log.Printf("Error saving state: %v", err)
+			}
+		}
+		log.Println("Shutdown complete")
+	case <-time.After(timeout + time.Second):
+		log.Printf("Shutdown did not finish within %s, forcing exit", timeout)
+		os.Exit(1)
+	}
 }
 
-func fetchPortStatistics(config Config) (PortStatistics, error) {
-	baseURL := "http://" + config.Address + "/port.cgi"
-	params := url.Values{}
-	params.Set("page", "stats")
+// startupDelay returns startup_delay_seconds plus a random share of
+// startup_jitter_seconds.
+func startupDelay(config Config) time.Duration {
+	delay := time.Duration(config.StartupDelay) * time.Second
+	if config.StartupJitter > 0 {
+		delay += time.Duration(rand.Int63n(int64(config.StartupJitter) * int64(time.Second)))
+	}
+	return delay
+}
 
-	formParams := url.Values{}
-	formParams.Set("username", config.Username)
-	formParams.Set("password", config.Password)
-	formParams.Set("language", "EN")
-	formParams.Set("Response", getMD5Hash(config.Username+config.Password))
+// listenAll opens a listener on every address of the comma-separated list.
+// If one cannot be opened, those already open are closed again.
+func listenAll(addresses string) ([]net.Listener, error) {
+	var listeners []net.Listener
+	for _, address := range strings.Split(addresses, ",") {
+		address = strings.TrimSpace(address)
+		if address == "" {
+			continue
+		}
+		listener, err := net.Listen("tcp", address)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, err
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("no address")
+	}
+	return listeners, nil
+}
+
+// serveAll serves handler on every listener, each with a server of its own
+// sharing the handler so reloads reach all of them.
+func serveAll(listeners []net.Listener, config Config, handler http.Handler, telemetryPath string) []*http.Server {
+	var servers []*http.Server
+	for _, listener := range listeners {
+		server := &http.Server{
+			Handler:           handler,
+			ReadTimeout:       time.Duration(config.WebReadTimeout) * time.Second,
+			ReadHeaderTimeout: time.Duration(config.WebReadTimeout) * time.Second,
+			WriteTimeout:      time.Duration(config.WebWriteTimeout) * time.Second,
+			IdleTimeout:       time.Duration(config.WebIdleTimeout) * time.Second,
+		}
+		servers = append(servers, server)
+		go func() {
+			log.Printf("Starting Prometheus exporter on %s%s", listener.Addr(), telemetryPath)
+			if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				log.Fatalf("HTTP server error on %s: %v", listener.Addr(), err)
+			}
+		}()
+	}
+	return servers
+}
 
-	client := &http.Client{
-		Timeout: time.Duration(config.Timeout) * time.Second,
+// shutdownAll shuts the servers down in parallel, letting in-flight
+// requests finish until ctx is done.
+func shutdownAll(ctx context.Context, servers []*http.Server) error {
+	errs := make(chan error, len(servers))
+	for _, server := range servers {
+		go func() {
+			errs <- server.Shutdown(ctx)
+		}()
 	}
+	var err error
+	for range servers {
+		err = errors.Join(err, <-errs)
+	}
+	return err
+}
 
-	req, err := http.NewRequest("GET", baseURL, strings.NewReader(formParams.Encode()))
+// newRouter sets up the exporter's HTTP endpoints for config, serving the
+// collectors of reload.
+func newRouter(config Config, reload *reloader) http.Handler {
+	collector, telemetryPath := reload.collector, reload.telemetryPath
+	mux := http.NewServeMux()
+	mux.Handle(telemetryPath, requireAuth(config, limitInFlight(config.WebMaxRequests, metricsHandler(collector, reload.discovered))))
+	if telemetryPath != "/" {
+		mux.Handle("/{$}", landingHandler(telemetryPath))
+	}
+	if config.EnableProbe {
+		mux.Handle("/probe", requireAuth(config, probeHandler(config)))
+	}
+	mux.Handle("/targets", requireAuth(config, targetsHandler(collector, reload.discovered)))
+	if config.InfluxEnabled {
+		mux.Handle("/influx", requireAuth(config, influxHandler(collector)))
+	}
+	if config.EnableControl {
+		mux.Handle("/counters/reset", requireAuth(config, counterResetHandler(config, collector)))
+		if config.CableDiagEnabled {
+			mux.Handle("/ports/{port}/cable-test", requireAuth(config, cableTestHandler(config, collector)))
+		}
+		mux.Handle("/reboot", requireAuth(config, rebootHandler(config, collector)))
+	}
+	if config.EnableReload {
+		mux.Handle("/-/reload", requireAuth(config, reloadHandler(reload)))
+	}
+	return mux
+}
+
+// StatsFetcher reads the port statistics from a switch. The collector uses
+// a configFetcher unless another one is set with SetFetcher.
+type StatsFetcher interface {
+	FetchPortStatistics(ctx context.Context) (PortStatistics, error)
+}
+
+// configFetcher fetches the statistics the way config describes, from the
+// web interface or over SNMP.
+type configFetcher struct {
+	config Config
+}
+
+func (f configFetcher) FetchPortStatistics(ctx context.Context) (PortStatistics, error) {
+	return fetchPortStatistics(ctx, f.config)
+}
+
+func fetchPortStatistics(ctx context.Context, config Config) (PortStatistics, error) {
+	switch config.CollectMode {
+	case "snmp":
+		return fetchSNMPPortStatistics(ctx, config)
+	case "telnet":
+		return fetchTelnetPortStatistics(ctx, config)
+	}
+	if len(config.StatsPages) > 0 {
+		return fetchStatsPages(ctx, config)
+	}
+
+	stats, _, err := fetchStatsPage(ctx, config, StatsPage{
+		Path:    config.StatsPath,
+		Columns: statsColumns(config),
+	})
+	return stats, err
+}
+
+// fetchStatsPage fetches and parses one statistics page, reading the HTML
+// table rows matched by its selector through its columns. For a JSON page,
+// which ignores the columns, it also returns the fields each port entry
+// carries by port name; it is nil for HTML pages.
+func fetchStatsPage(ctx context.Context, config Config, statsPage StatsPage) (PortStatistics, map[string][]string, error) {
+	page, err := fetchPage(ctx, config, statsPage.Path)
 	if err != nil {
-		return PortStatistics{}, fmt.Errorf("error creating request: %w", err)
+		return PortStatistics{}, nil, err
+	}
+	if dumpHTML != nil {
+		if _, err := dumpHTML.Write(page.body); err != nil {
+			log.Printf("Error dumping stats page: %v", err)
+		}
 	}
 
-	cookieValue := getMD5Hash(config.Username + config.Password)
-	req.AddCookie(&http.Cookie{Name: "admin", Value: cookieValue})
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	req.URL.RawQuery = params.Encode()
+	// Newer firmware serves the same page as JSON
+	if page.isJSON() {
+		stats, err := parsePortStatisticsJSON(page.body)
+		if err != nil {
+			return PortStatistics{}, nil, err
+		}
+		return stats, jsonPortFields(page.body), nil
+	}
+
+	doc, err := page.document()
+	if err != nil {
+		return PortStatistics{}, nil, err
+	}
+	// The stock firmware answers with its login form instead of an error
+	if doc.Find(`input[type="password"]`).Length() > 0 {
+		return PortStatistics{}, nil, fmt.Errorf("%w: got the login page", errLoginFailed)
+	}
+
+	selector := statsPage.TableSelector
+	if selector == "" {
+		selector = config.TableSelector
+	}
+	var stats PortStatistics
+	if config.StatsFormat == "text_table" {
+		stats = parseTextTable(doc, config)
+	} else {
+		stats, err = parseStatsTable(doc, selector, statsPage.Columns, statsPage.Cells, config.NumberFormat)
+	}
+	if config.SwitchTimeSelector != "" {
+		stats.SwitchTime = parseSwitchTime(doc, config)
+	}
+	return stats, nil, err
+}
+
+// switchPage is a raw response body from the switch web interface.
+type switchPage struct {
+	body        []byte
+	contentType string
+}
+
+func (p switchPage) isJSON() bool {
+	if strings.Contains(p.contentType, "json") {
+		return true
+	}
+	trimmed := bytes.TrimSpace(p.body)
+	return len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+}
+
+// document parses the page as HTML. A page missing the closing tag of its
+// html element or last table is rejected rather than parsed into partial
+// rows.
+func (p switchPage) document() (*goquery.Document, error) {
+	lower := bytes.ToLower(p.body)
+	if bytes.Contains(lower, []byte("<html")) && !bytes.Contains(lower, []byte("</html>")) {
+		return nil, fmt.Errorf("%w: no closing html tag in %d bytes", errTruncated, len(p.body))
+	}
+	if i := bytes.LastIndex(lower, []byte("<table")); i >= 0 && !bytes.Contains(lower[i:], []byte("</table>")) {
+		return nil, fmt.Errorf("%w: no closing table tag in %d bytes", errTruncated, len(p.body))
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(p.body))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing HTML: %w", err)
+	}
+	return doc, nil
+}
+
+// fetchDocument requests a page from the switch web interface and parses it
+// as HTML.
+func fetchDocument(ctx context.Context, config Config, path string) (*goquery.Document, error) {
+	page, err := fetchPage(ctx, config, path)
+	if err != nil {
+		return nil, err
+	}
+	return page.document()
+}
+
+// fetchPage requests a page from the switch web interface and reads the
+// whole body.
+func fetchPage(ctx context.Context, config Config, path string) (switchPage, error) {
+	release, err := acquireSwitch(ctx, config)
+	if err != nil {
+		return switchPage{}, err
+	}
+	defer release()
+	client := newHTTPClient(config)
+
+	req, err := newSwitchRequest(ctx, config, "GET", path)
+	if err != nil {
+		return switchPage{}, fmt.Errorf("error creating request: %w", err)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return PortStatistics{}, fmt.Errorf("error sending request: %w", err)
+		return switchPage{}, fmt.Errorf("error sending request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	doc, err := goquery.NewDocumentFromReader(resp.Body)
+	if resp.StatusCode >= 100 && resp.StatusCode <= 599 {
+		switchHTTPResponses.WithLabelValues(config.Address, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return switchPage{}, fmt.Errorf("%w: status code %d", errLoginFailed, resp.StatusCode)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return switchPage{}, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return PortStatistics{}, fmt.Errorf("error parsing HTML: %w", err)
+		return switchPage{}, fmt.Errorf("error reading response: %w", err)
 	}
 
-	return parsePortStatistics(doc)
+	return switchPage{body: body, contentType: resp.Header.Get("Content-Type")}, nil
+}
+
+// newSwitchRequest builds a request for a CGI path on the switch carrying the
+// login form and session cookie the web interface expects, or only the API
+// token with auth_mode bearer. The form is sent in the body or, with
+// form_placement query, in the URL.
+func newSwitchRequest(ctx context.Context, config Config, method, path string) (*http.Request, error) {
+	if config.AuthMode == "bearer" {
+		req, err := http.NewRequestWithContext(ctx, method, switchURL(config, path), nil)
+		if err != nil {
+			return nil, err
+		}
+		setRequestHeaders(req, config)
+		req.Header.Set("Authorization", "Bearer "+config.APIToken)
+		return req, nil
+	}
+
+	formParams := url.Values{}
+	for name, value := range map[string]string{
+		"username": config.Username,
+		"password": config.Password,
+		"language": "EN",
+		"response": getMD5Hash(config.Username + config.Password),
+	} {
+		if field := loginField(config, name); field != "" {
+			formParams.Set(field, value)
+		}
+	}
+
+	if config.FormPlacement == "query" {
+		path += querySeparator(path) + formParams.Encode()
+	}
+	var body io.Reader
+	if config.FormPlacement == "body" {
+		body = strings.NewReader(formParams.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, switchURL(config, path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	setRequestHeaders(req, config)
+	cookieValue := getMD5Hash(config.Username + config.Password)
+	req.AddCookie(&http.Cookie{Name: "admin", Value: cookieValue})
+	if body != nil {
+		req.Header.Set("Content-Type", config.FormContentType)
+	}
+
+	return req, nil
+}
+
+// managedHeaders are set by the exporter or net/http itself and cannot be
+// given in request_headers.
+var managedHeaders = []string{"Authorization", "Cookie", "Content-Type", "Content-Length", "Host", "Transfer-Encoding"}
+
+// setRequestHeaders adds the request_headers of config to req.
+func setRequestHeaders(req *http.Request, config Config) {
+	for name, value := range config.RequestHeaders {
+		req.Header.Set(name, value)
+	}
+}
+
+func validateRequestHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.ContainsAny(name, " \t:\r\n") {
+			return fmt.Errorf("invalid request_headers name %q", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("invalid value for request_headers entry %q", name)
+		}
+		if slices.Contains(managedHeaders, textproto.CanonicalMIMEHeaderKey(name)) {
+			return fmt.Errorf("request_headers cannot set %s, the exporter manages it", name)
+		}
+	}
+	return nil
+}
+
+// defaultLoginFields are the field names of the stock login form by the
+// value they carry.
+var defaultLoginFields = map[string]string{
+	"username": "username",
+	"password": "password",
+	"language": "language",
+	"response": "Response",
+}
+
+// loginField returns the form field name for the login value name.
+func loginField(config Config, name string) string {
+	if field, ok := config.LoginFields[name]; ok {
+		return field
+	}
+	return defaultLoginFields[name]
+}
+
+// switchURL joins the switch address, the base path and a CGI path,
+// tolerating missing or doubled slashes between them.
+func switchURL(config Config, path string) string {
+	base := strings.Trim(config.BasePath, "/")
+	if base != "" {
+		base = "/" + base
+	}
+	return "http://" + config.Address + base + "/" + strings.TrimPrefix(path, "/")
+}
+
+func newHTTPClient(config Config) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: time.Duration(config.ConnectTimeout) * time.Second,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Every request gets a fresh client, so kept-alive connections would
+	// only pile up; the switches tolerate few of them anyway
+	transport.DisableKeepAlives = true
+
+	if config.SourceAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(config.SourceAddress)}
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, fmt.Errorf("error connecting from source address %s: %w", config.SourceAddress, err)
+			}
+			return conn, nil
+		}
+	}
+	if config.SSHHost != "" {
+		// URLs keep the switch address for the Host header, only the
+		// connection goes to the tunnel
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			tunnel, err := openSSHTunnel(config)
+			if err != nil {
+				return nil, err
+			}
+			return dialer.DialContext(ctx, network, tunnel.Addr())
+		}
+	}
+
+	return &http.Client{
+		Timeout:   time.Duration(config.Timeout) * time.Second,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			// Parsing the login page the switch sends unauthenticated
+			// clients to would only produce garbage
+			if isLoginRedirect(req.URL) {
+				return fmt.Errorf("%w: %w to %s", errLoginFailed, errRedirected, req.URL.Path)
+			}
+			if config.RedirectPolicy == "error" {
+				return fmt.Errorf("%w to %s", errRedirected, req.URL)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// isLoginRedirect reports whether a redirect target looks like the login or
+// index page of the web interface.
+func isLoginRedirect(u *url.URL) bool {
+	path := strings.ToLower(u.Path)
+	return path == "" || path == "/" || strings.Contains(path, "login") || strings.Contains(path, "index")
+}
+
+// validateSourceAddress checks that the address is an IP assigned to this
+// host by binding a throwaway socket to it.
+func validateSourceAddress(address string) error {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return fmt.Errorf("%q is not an IP address", address)
+	}
+
+	conn, err := net.ListenPacket("udp", net.JoinHostPort(ip.String(), "0"))
+	if err != nil {
+		return fmt.Errorf("cannot bind to %s: %w", address, err)
+	}
+	return conn.Close()
 }
 
 func parsePortStatistics(doc *goquery.Document) (PortStatistics, error) {
+	return parseStatsTable(doc, defaultTableSelector, defaultStatsColumns, 0, "plain")
+}
+
+// parseStatsTable reads one port per row matched by selector after the
+// header, taking each field from the cell at its index in columns. Fields
+// without a column keep their zero value. Rows with a cell count other than
+// cells, or too few cells for columns if cells is 0, are counted in
+// columnMismatches but still parsed. Counters are read in numberFormat.
+func parseStatsTable(doc *goquery.Document, selector string, columns map[string]int, cells int, numberFormat string) (PortStatistics, error) {
 	var stats PortStatistics
 
-	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+	required := 0
+	for _, column := range columns {
+		required = max(required, column+1)
+	}
+
+	rows := doc.Find(selector)
+	// Navigation or footer tables must not turn into ports
+	if selector == defaultTableSelector {
+		rows = statsTableRows(doc, required, cells)
+	}
+	rows.Each(func(i int, s *goquery.Selection) {
 		if i != 0 {
 			port := Port{}
-			s.Find("td").Each(func(j int, td *goquery.Selection) {
-				switch j {
-				case 0:
-					port.Name = td.Text()
-				case 1:
-					port.State = td.Text()
-				case 2:
-					port.LinkStatus = td.Text()
-				case 3:
-					port.TxGoodPkt = parseStatValue(td.Text())
-				case 4:
-					port.RxGoodPkt = parseStatValue(td.Text())
-				case 5:
-					port.RxGoodBytes = parseStatValue(td.Text())
-				case 6:
-					port.TxGoodBytes = parseStatValue(td.Text())
+			tds := s.Find("td")
+			if n := tds.Length(); n > 0 && (n < required || cells > 0 && n != cells) {
+				columnMismatches.Inc()
+				debugf("Stats row %d has %d cells, the layout expects %d", i, n, max(cells, required))
+			}
+			tds.Each(func(j int, td *goquery.Selection) {
+				for field, column := range columns {
+					if column == j {
+						setPortField(&port, field, td.Text(), numberFormat)
+					}
 				}
 			})
+			if port.Name == "" {
+				debugf("Skipping stats row %d without a port name", i)
+				return
+			}
 			stats.Ports = append(stats.Ports, port)
 		}
 	})
@@ -264,51 +1739,110 @@ func parsePortStatistics(doc *goquery.Document) (PortStatistics, error) {
 	return stats, nil
 }
 
-func stateToFloat(state string) float64 {
-	return map[string]float64{
-		"Enable":  1.0,
-		"Disable": 0.0,
-	}[state]
-}
+// parsePortStatisticsJSON decodes the JSON variant of the stats page, either
+// an object with a port_statistics list or a bare list of ports.
+func parsePortStatisticsJSON(body []byte) (PortStatistics, error) {
+	var stats PortStatistics
+
+	body = bytes.TrimSpace(body)
+	var err error
+	if len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &stats.Ports)
+	} else {
+		err = json.Unmarshal(body, &stats)
+	}
+	if err != nil {
+		return PortStatistics{}, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	// Names are trimmed like the cells of the HTML table, and like table
+	// rows without a port cell, entries without a name cannot be told apart
+	for i := range stats.Ports {
+		stats.Ports[i].Name = strings.TrimSpace(stats.Ports[i].Name)
+	}
+	stats.Ports = slices.DeleteFunc(stats.Ports, func(port Port) bool {
+		if port.Name == "" {
+			debugf("Skipping JSON port entry without a name")
+			return true
+		}
+		return false
+	})
 
-func linkStatusToFloat(status string) float64 {
-	return map[string]float64{
-		"Link Up":   1.0,
-		"Link Down": 0.0,
-	}[status]
+	return stats, nil
 }
 
-func getMD5Hash(text string) string {
-	hash := md5.Sum([]byte(text))
-	return hex.EncodeToString(hash[:])
+// DefaultStateValues maps the port state text of the stock firmware to
+// metric values. Entries from the state_values config are added on top.
+var DefaultStateValues = map[string]float64{
+	"Enable":  1.0,
+	"Disable": 0.0,
 }
 
-func readConfig(filename string) (Config, error) {
-	var config Config
+// DefaultLinkStatusValues maps the link status text of the stock firmware to
+// metric values. Entries from the link_status_values config are added on top.
+var DefaultLinkStatusValues = map[string]float64{
+	"Link Up":   1.0,
+	"Link Down": 0.0,
+}
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return config, err
+func mergeValues(defaults, overrides map[string]float64) map[string]float64 {
+	merged := make(map[string]float64, len(defaults)+len(overrides))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
 	}
+	return merged
+}
 
-	err = yaml.Unmarshal(data, &config)
-	if err != nil {
-		return config, err
+func (c *PortStatsCollector) portRole(name string) string {
+	if role, ok := c.config.PortRoles[name]; ok {
+		return role
 	}
+	return "unknown"
+}
 
-	return config, nil
+func (c *PortStatsCollector) stateToFloat(state string) float64 {
+	return c.stateValues[state]
 }
 
-func parseStatValue(val string) uint64 {
+func (c *PortStatsCollector) linkStatusToFloat(status string) float64 {
+	return c.linkStatusValues[status]
+}
+
+// stateMismatch reports whether port is enabled but its link is down. An
+// unknown link status text is not taken for down.
+func (c *PortStatsCollector) stateMismatch(port Port) bool {
+	link, known := c.linkStatusValues[port.LinkStatus]
+	return c.stateToFloat(port.State) != 0 && known && link == 0
+}
+
+func getMD5Hash(text string) string {
+	hash := md5.Sum([]byte(text))
+	return hex.EncodeToString(hash[:])
+}
+
+// parseStatValue reads a counter, either a plain number or the high and low
+// 32 bits joined by a dash. The grouping separator, if any, is removed
+// first. Halves wider than 32 bits and numbers wider than 64 bits read as 0
+// rather than a meaningless value.
+func parseStatValue(val, separator string) uint64 {
 	val = strings.TrimSpace(val)
+	if separator != "" {
+		val = strings.ReplaceAll(val, separator, "")
+	}
 	parts := strings.Split(val, "-")
 	if len(parts) == 2 {
-		high, err1 := strconv.ParseUint(parts[0], 10, 64)
-		low, err2 := strconv.ParseUint(parts[1], 10, 64)
+		high, err1 := strconv.ParseUint(parts[0], 10, 32)
+		low, err2 := strconv.ParseUint(parts[1], 10, 32)
 		if err1 == nil && err2 == nil {
 			return (high << 32) + low
 		}
 	}
-	res, _ := strconv.ParseUint(val, 10, 64)
+	// ParseUint returns the maximum on overflow, an absurd counter value
+	res, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return 0
+	}
 	return res
 }
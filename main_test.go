@@ -0,0 +1,660 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// fakeSwitch serves fixture pages the way the stock firmware does: a
+// request without the login form and cookie gets the login page.
+type fakeSwitch struct {
+	*httptest.Server
+	username string
+	password string
+
+	mutex    sync.Mutex
+	pages    map[string]string
+	requests []string
+}
+
+// newFakeSwitch starts a switch serving pages by request URI, e.g.
+// "/port.cgi?page=stats", with the credentials admin/secret.
+func newFakeSwitch(t *testing.T, pages map[string]string) *fakeSwitch {
+	t.Helper()
+	s := &fakeSwitch{username: "admin", password: "secret", pages: pages}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *fakeSwitch) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	s.requests = append(s.requests, r.RequestURI)
+	page, ok := s.pages[r.RequestURI]
+	s.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	form, _ := url.ParseQuery(string(body))
+	cookie, err := r.Cookie("admin")
+	response := getMD5Hash(s.username + s.password)
+	if form.Get("username") != s.username || form.Get("password") != s.password ||
+		form.Get("Response") != response || err != nil || cookie.Value != response {
+		w.Write([]byte(s.loginPage()))
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html")
+	w.Write([]byte(page))
+}
+
+func (s *fakeSwitch) loginPage() string {
+	data, err := os.ReadFile(filepath.Join("testdata", "login.html"))
+	if err != nil {
+		panic(err)
+	}
+	return string(data)
+}
+
+// SetPage replaces the page served at uri.
+func (s *fakeSwitch) SetPage(uri, page string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.pages[uri] = page
+}
+
+// Requests returns the request URIs received so far.
+func (s *fakeSwitch) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Address is the host:port of the switch for the address config field.
+func (s *fakeSwitch) Address() string {
+	return strings.TrimPrefix(s.URL, "http://")
+}
+
+func readFixture(t testing.TB, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// testConfig is a valid configuration for the switch at address with the
+// credentials of fakeSwitch, after edit has been applied.
+func testConfig(t *testing.T, address string, edit func(*Config)) Config {
+	t.Helper()
+	config := Config{Address: address, Username: "admin", Password: "secret"}
+	if edit != nil {
+		edit(&config)
+	}
+	applyDefaults(&config)
+	if err := validateConfig(config); err != nil {
+		t.Fatalf("invalid test configuration: %v", err)
+	}
+	return config
+}
+
+// newTestRouter serves the exporter for config like main does.
+func newTestRouter(config Config) (http.Handler, *PortStatsCollector) {
+	collector := NewPortStatsCollector(config, prometheus.NewRegistry())
+	reload := &reloader{
+		telemetryPath: "/metrics",
+		collector:     collector,
+		handler:       &swapHandler{},
+	}
+	return newRouter(config, reload), collector
+}
+
+// get requests path from handler and returns the status and body.
+func get(t *testing.T, handler http.Handler, path string) (int, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, path, nil))
+	return recorder.Code, recorder.Body.String()
+}
+
+// metricValue returns the value of series on a /metrics page.
+func metricValue(t *testing.T, body, series string) float64 {
+	t.Helper()
+	for _, line := range strings.Split(body, "\n") {
+		if value, ok := strings.CutPrefix(line, series+" "); ok {
+			v, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return v
+		}
+	}
+	t.Fatalf("missing %s in:\n%s", series, body)
+	return 0
+}
+
+// fakeFetcher serves port statistics set by the test, for collector tests
+// that do not care how the switch is read.
+type fakeFetcher struct {
+	mutex sync.Mutex
+	stats PortStatistics
+	err   error
+	calls int
+}
+
+func (f *fakeFetcher) FetchPortStatistics(context.Context) (PortStatistics, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls++
+	// Like a real fetch, every call gets ports of its own
+	stats := f.stats
+	stats.Ports = slices.Clone(stats.Ports)
+	return stats, f.err
+}
+
+// Set makes the following fetches return stats and err.
+func (f *fakeFetcher) Set(stats PortStatistics, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.stats, f.err = stats, err
+}
+
+// Calls returns the number of fetches so far.
+func (f *fakeFetcher) Calls() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls
+}
+
+// testPorts are two ports with distinct counters.
+func testPorts() PortStatistics {
+	return PortStatistics{Ports: []Port{
+		{Name: "Port 1", State: "Enable", LinkStatus: "Link Up", TxGoodPkt: 10, RxGoodPkt: 20, RxGoodBytes: 3000, TxGoodBytes: 4000},
+		{Name: "Port 2", State: "Enable", LinkStatus: "Link Down"},
+	}}
+}
+
+// newFakeRouter serves a collector for config reading from a fakeFetcher.
+func newFakeRouter(config Config) (http.Handler, *PortStatsCollector, *fakeFetcher) {
+	router, collector := newTestRouter(config)
+	fetcher := &fakeFetcher{stats: testPorts()}
+	collector.SetFetcher(fetcher)
+	return router, collector, fetcher
+}
+
+// metricFamilyPresent reports whether body has a sample of the family name.
+func metricFamilyPresent(body, name string) bool {
+	return strings.Contains(body, "\n"+name+" ") || strings.Contains(body, "\n"+name+"{")
+}
+
+func assertNotContains(t *testing.T, body string, substrings ...string) {
+	t.Helper()
+	for _, substring := range substrings {
+		if strings.Contains(body, substring) {
+			t.Errorf("unexpected %q in:\n%s", substring, body)
+		}
+	}
+}
+
+func assertContains(t *testing.T, body string, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("missing %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsFromFakeSwitch(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), nil))
+
+	code, body := get(t, router, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d", code)
+	}
+	assertContains(t, body,
+		`switch_up 1`,
+		`port_state{port="Port 1",role="unknown"} 1`,
+		`port_state{port="Port 3",role="unknown"} 0`,
+		`port_link_status{port="Port 1",role="unknown"} 1`,
+		`port_link_status{port="Port 2",role="unknown"} 0`,
+		`port_tx_good_pkt{port="Port 1",role="unknown"} 1523`,
+		`port_rx_good_pkt{port="Port 1",role="unknown"} 2087`,
+		`port_rx_good_bytes{port="Port 1",role="unknown"} 4.29496832e+09`,
+		`port_tx_good_bytes{port="Port 1",role="unknown"} 987654`,
+		`port_rx_good_bytes{port="Port 3",role="unknown"} 5600`,
+	)
+	if requests := sw.Requests(); len(requests) != 1 || requests[0] != "/port.cgi?page=stats" {
+		t.Errorf("got requests %v, want one for the stats page", requests)
+	}
+}
+
+func TestMetricsServedFromCache(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), nil))
+
+	get(t, router, "/metrics")
+	get(t, router, "/metrics")
+	if n := len(sw.Requests()); n != 1 {
+		t.Errorf("got %d requests within the poll rate, want 1", n)
+	}
+}
+
+func TestWrongCredentials(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	config := testConfig(t, sw.Address(), func(c *Config) { c.Password = "wrong" })
+	router, collector := newTestRouter(config)
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `switch_up 0`)
+	if strings.Contains(body, "port_state{") {
+		t.Errorf("port metrics exported after a rejected login:\n%s", body)
+	}
+	if collector.loginBackoff == 0 {
+		t.Error("logins not suspended after the switch rejected the credentials")
+	}
+}
+
+func TestStatusPagesDuringLoginBackoff(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/info.cgi":            readFixture(t, "environment_nofan.html"),
+	})
+	router, collector := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.Password = "wrong"
+		c.EnvironmentEnabled = true
+	}))
+
+	for range 3 {
+		get(t, router, "/metrics")
+	}
+	if slices.Contains(sw.Requests(), "/info.cgi") {
+		t.Errorf("status page fetched while logins back off: %q", sw.Requests())
+	}
+
+	collector.Reload(testConfig(t, sw.Address(), func(c *Config) { c.EnvironmentEnabled = true }))
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `switch_temperature_celsius 52`)
+}
+
+func TestLoginBackoff(t *testing.T) {
+	router, collector, fetcher := newFakeRouter(testConfig(t, "192.168.1.1", nil))
+	fetcher.Set(PortStatistics{}, fmt.Errorf("%w: got the login page", errLoginFailed))
+
+	// elapse pretends the backoff has run out
+	elapse := func() { collector.loginRetryAt = time.Now().Add(-time.Second) }
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `switch_up 0`)
+	if collector.loginBackoff != 10*time.Second {
+		t.Errorf("got backoff %s after the first rejection, want the poll rate", collector.loginBackoff)
+	}
+
+	for range 3 {
+		get(t, router, "/metrics")
+	}
+	if calls := fetcher.Calls(); calls != 1 {
+		t.Errorf("got %d fetches while backing off, want 1", calls)
+	}
+
+	for _, want := range []time.Duration{20 * time.Second, 40 * time.Second} {
+		elapse()
+		get(t, router, "/metrics")
+		if collector.loginBackoff != want {
+			t.Errorf("got backoff %s, want %s", collector.loginBackoff, want)
+		}
+	}
+	if until := time.Until(collector.loginRetryAt); until < 40*time.Second || until > 48*time.Second {
+		t.Errorf("next login in %s, want 40s plus up to 20%% jitter", until)
+	}
+	for range 10 {
+		elapse()
+		get(t, router, "/metrics")
+	}
+	if collector.loginBackoff != maxLoginBackoff {
+		t.Errorf("got backoff %s, want it capped at %s", collector.loginBackoff, maxLoginBackoff)
+	}
+
+	fetcher.Set(testPorts(), nil)
+	elapse()
+	_, body = get(t, router, "/metrics")
+	assertContains(t, body, `switch_up 1`)
+	if failures := testutil.ToFloat64(collector.loginFailures); failures != 13 {
+		t.Errorf("got %v login failures, want one per attempt", failures)
+	}
+	if collector.loginBackoff != 0 || !collector.loginRetryAt.IsZero() {
+		t.Errorf("backoff %s kept after a successful login", collector.loginBackoff)
+	}
+}
+
+func TestLoginForm(t *testing.T) {
+	var form url.Values
+	var cookie string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ = url.ParseQuery(string(body))
+		if c, err := r.Cookie("admin"); err == nil {
+			cookie = c.Value
+		}
+		w.Write([]byte(readFixture(t, "stats.html")))
+	}))
+	defer server.Close()
+
+	config := testConfig(t, strings.TrimPrefix(server.URL, "http://"), nil)
+	if _, err := fetchPortStatistics(context.Background(), config); err != nil {
+		t.Fatal(err)
+	}
+	want := url.Values{
+		"username": {"admin"},
+		"password": {"secret"},
+		"language": {"EN"},
+		"Response": {getMD5Hash("adminsecret")},
+	}
+	if form.Encode() != want.Encode() {
+		t.Errorf("got form %v, want %v", form, want)
+	}
+	if cookie != getMD5Hash("adminsecret") {
+		t.Errorf("got cookie %q", cookie)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/port.cgi":
+			http.Redirect(w, r, "/index.cgi", http.StatusFound)
+		case "/moved.cgi":
+			http.Redirect(w, r, "/stats.cgi", http.StatusFound)
+		case "/stats.cgi":
+			w.Write([]byte(readFixture(t, "stats.html")))
+		default:
+			w.Write([]byte(readFixture(t, "login.html")))
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	tests := []struct {
+		name        string
+		path        string
+		policy      string
+		loginFailed bool
+		redirected  bool
+	}{
+		{"to the index page", "/port.cgi?page=stats", "follow", true, true},
+		{"elsewhere, followed", "/moved.cgi", "follow", false, false},
+		{"elsewhere, refused", "/moved.cgi", "error", false, true},
+	}
+	for _, tt := range tests {
+		config := testConfig(t, address, func(c *Config) {
+			c.StatsPath = tt.path
+			c.RedirectPolicy = tt.policy
+		})
+		_, err := fetchPortStatistics(context.Background(), config)
+		if errors.Is(err, errLoginFailed) != tt.loginFailed || errors.Is(err, errRedirected) != tt.redirected {
+			t.Errorf("%s: got error %v", tt.name, err)
+		}
+
+		router, _ := newTestRouter(config)
+		_, body := get(t, router, "/metrics")
+		if tt.redirected {
+			assertContains(t, body, `switch_redirect_detected 1`, `switch_up 0`)
+		} else {
+			assertContains(t, body, `switch_redirect_detected 0`, `switch_up 1`)
+		}
+	}
+}
+
+func TestStateAndLinkStatusValues(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", func(c *Config) {
+		c.StateValues = map[string]float64{"on": 1, "off": 0, "Disable": 0.5}
+		c.LinkStatusValues = map[string]float64{"1000M Full": 1}
+	})
+	collector := NewPortStatsCollector(config, prometheus.NewRegistry())
+
+	states := []struct {
+		text string
+		want float64
+	}{
+		{"Enable", 1},
+		{"Disable", 0.5},
+		{"on", 1},
+		{"off", 0},
+		{"ON", 0},
+		{"Enabled", 0},
+		{"", 0},
+	}
+	for _, tt := range states {
+		if got := collector.stateToFloat(tt.text); got != tt.want {
+			t.Errorf("stateToFloat(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	links := []struct {
+		text string
+		want float64
+	}{
+		{"Link Up", 1},
+		{"Link Down", 0},
+		{"1000M Full", 1},
+		{"100M Half", 0},
+		{"", 0},
+	}
+	for _, tt := range links {
+		if got := collector.linkStatusToFloat(tt.text); got != tt.want {
+			t.Errorf("linkStatusToFloat(%q) = %v, want %v", tt.text, got, tt.want)
+		}
+	}
+
+	if _, ok := DefaultStateValues["on"]; ok {
+		t.Error("state_values leaked into DefaultStateValues")
+	}
+}
+
+func TestMetricsAge(t *testing.T) {
+	router, collector, fetcher := newFakeRouter(testConfig(t, "192.168.1.1", nil))
+
+	_, body := get(t, router, "/metrics")
+	if age := metricValue(t, body, "exporter_metrics_age_seconds"); age > 1 {
+		t.Errorf("got age %v after a fresh fetch, want 0", age)
+	}
+
+	// Each scrape after the poll rate fails and serves older stats
+	fetcher.Set(PortStatistics{}, errors.New("connection refused"))
+	var last float64
+	for i := 1; i < collector.config.MaxConsecutiveFailures; i++ {
+		collector.lastSuccess = collector.lastSuccess.Add(-time.Minute)
+		_, body = get(t, router, "/metrics")
+		age := metricValue(t, body, "exporter_metrics_age_seconds")
+		if age < float64(i*60) || age <= last {
+			t.Errorf("scrape %d: got age %v, want it to grow past %d", i, age, i*60)
+		}
+		last = age
+		assertContains(t, body, `port_tx_good_pkt{port="Port 1",role="unknown"} 10`)
+	}
+
+	// The stats are dropped once max_consecutive_failures is reached
+	_, body = get(t, router, "/metrics")
+	if strings.Contains(body, "exporter_metrics_age_seconds") || strings.Contains(body, "port_tx_good_pkt") {
+		t.Errorf("stale stats served after %d failures:\n%s", collector.config.MaxConsecutiveFailures, body)
+	}
+}
+
+func TestMetricsFromJSONFirmware(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.json"),
+	})
+	config := testConfig(t, sw.Address(), func(c *Config) {
+		c.StateValues = map[string]float64{"1": 1}
+	})
+	router, _ := newTestRouter(config)
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`switch_up 1`,
+		`port_state{port="Port 2",role="unknown"} 1`,
+		`port_rx_good_bytes{port="Port 1",role="unknown"} 4.29496832e+09`,
+		`port_tx_good_pkt{port="Port 3",role="unknown"} 12`,
+	)
+	if strings.Contains(body, `port=""`) || strings.Contains(body, `port=" Port 2 "`) {
+		t.Errorf("untrimmed or empty port names exported:\n%s", body)
+	}
+}
+
+func TestDuplicatePortNames(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats_duplicate.html"),
+	})
+	router, collector := newTestRouter(testConfig(t, sw.Address(), nil))
+
+	code, body := get(t, router, "/metrics")
+	if code != http.StatusOK {
+		t.Fatalf("got status %d: %s", code, body)
+	}
+	// The first row of a port wins
+	assertContains(t, body,
+		`switch_up 1`,
+		`port_link_status{port="Port 2",role="unknown"} 0`,
+		`port_tx_good_pkt{port="Port 2",role="unknown"} 0`,
+		`port_tx_good_pkt{port="Port 3",role="unknown"} 12`,
+	)
+	if n := strings.Count(body, `port_tx_good_pkt{port="Port 2"`); n != 1 {
+		t.Errorf("got %d series for the duplicated port, want 1", n)
+	}
+	if n := testutil.ToFloat64(collector.duplicatePorts); n != 1 {
+		t.Errorf("got exporter_duplicate_ports_total %v, want 1", n)
+	}
+}
+
+func TestSwitchConnectionsClosed(t *testing.T) {
+	sw := &fakeSwitch{username: "admin", password: "secret", pages: map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	}}
+	sw.Server = httptest.NewUnstartedServer(http.HandlerFunc(sw.serve))
+	var mutex sync.Mutex
+	open := 0
+	sw.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch state {
+		case http.StateNew:
+			open++
+		case http.StateClosed, http.StateHijacked:
+			open--
+		}
+	}
+	sw.Start()
+	defer sw.Close()
+	config := testConfig(t, sw.Address(), nil)
+
+	for range 5 {
+		if _, err := fetchPortStatistics(context.Background(), config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The server sees the close shortly after the response
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mutex.Lock()
+		n := open
+		mutex.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d connections to the switch left open", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSwitchHTTPResponsesBySwitch(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	other := newFakeSwitch(t, map[string]string{})
+	for _, address := range []string{sw.Address(), other.Address()} {
+		fetchPortStatistics(context.Background(), testConfig(t, address, nil))
+	}
+
+	if n := testutil.ToFloat64(switchHTTPResponses.WithLabelValues(sw.Address(), "200")); n != 1 {
+		t.Errorf("got %v responses with 200 from %s, want 1", n, sw.Address())
+	}
+	if n := testutil.ToFloat64(switchHTTPResponses.WithLabelValues(other.Address(), "404")); n != 1 {
+		t.Errorf("got %v responses with 404 from %s, want 1", n, other.Address())
+	}
+}
+
+func TestMultipleListenAddresses(t *testing.T) {
+	listeners, err := listenAll("127.0.0.1:0, ,127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(listeners) != 2 {
+		t.Fatalf("got %d listeners, want 2", len(listeners))
+	}
+	config := testConfig(t, "192.168.1.1", nil)
+	router, _, _ := newFakeRouter(config)
+	servers := serveAll(listeners, config, router, "/metrics")
+
+	for _, listener := range listeners {
+		resp, err := http.Get("http://" + listener.Addr().String() + "/metrics")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		assertContains(t, string(body), `port_state{port="Port 1",role="unknown"} 1`)
+	}
+
+	if err := shutdownAll(context.Background(), servers); err != nil {
+		t.Fatal(err)
+	}
+	for _, listener := range listeners {
+		if _, err := http.Get("http://" + listener.Addr().String() + "/metrics"); err == nil {
+			t.Errorf("%s still serving after the shutdown", listener.Addr())
+		}
+	}
+}
+
+func TestListenAllFailure(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	if _, err := listenAll(" , "); err == nil {
+		t.Error("listening on no address succeeded")
+	}
+	if _, err := listenAll("127.0.0.1:0," + taken.Addr().String()); err == nil {
+		t.Error("listening on a taken address succeeded")
+	}
+}
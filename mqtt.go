@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// StatsPublisher receives every set of port statistics freshly fetched from
+// the switch. Publish is called with the collector lock held and must not
+// block on the network.
+type StatsPublisher interface {
+	Publish(stats PortStatistics)
+}
+
+// MQTTPublisher publishes one retained topic per port metric, e.g.
+// switch/Port_1/link = 1.
+type MQTTPublisher struct {
+	client           mqtt.Client
+	prefix           string
+	stateValues      map[string]float64
+	linkStatusValues map[string]float64
+}
+
+var topicReplacer = strings.NewReplacer(" ", "_", "/", "_", "+", "_", "#", "_")
+
+func NewMQTTPublisher(config Config) *MQTTPublisher {
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.MQTTBroker).
+		SetClientID(config.MQTTClientID).
+		SetUsername(config.MQTTUsername).
+		SetPassword(config.MQTTPassword).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(10 * time.Second).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT connection lost: %v", err)
+		})
+
+	client := mqtt.NewClient(opts)
+	// With ConnectRetry the client keeps trying in the background, so the
+	// token is not waited on.
+	client.Connect()
+
+	return &MQTTPublisher{
+		client:           client,
+		prefix:           strings.TrimSuffix(config.MQTTTopicPrefix, "/"),
+		stateValues:      mergeValues(DefaultStateValues, config.StateValues),
+		linkStatusValues: mergeValues(DefaultLinkStatusValues, config.LinkStatusValues),
+	}
+}
+
+func (p *MQTTPublisher) Publish(stats PortStatistics) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+
+	for _, port := range stats.Ports {
+		base := p.prefix + "/" + topicReplacer.Replace(port.Name)
+		p.publish(base+"/state", formatFloat(p.stateValues[port.State]))
+		p.publish(base+"/link", formatFloat(p.linkStatusValues[port.LinkStatus]))
+		p.publish(base+"/tx_good_pkt", strconv.FormatUint(port.TxGoodPkt, 10))
+		p.publish(base+"/rx_good_pkt", strconv.FormatUint(port.RxGoodPkt, 10))
+		p.publish(base+"/tx_good_bytes", strconv.FormatUint(port.TxGoodBytes, 10))
+		p.publish(base+"/rx_good_bytes", strconv.FormatUint(port.RxGoodBytes, 10))
+	}
+}
+
+func (p *MQTTPublisher) publish(topic, payload string) {
+	p.client.Publish(topic, 0, true, payload)
+}
+
+func (p *MQTTPublisher) Close() {
+	p.client.Disconnect(250)
+}
+
+func formatFloat(v float64) string {
+	return fmt.Sprint(v)
+}
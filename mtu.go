@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FrameSizes holds the MTU setting in bytes, per port where the firmware
+// has an MTU column and as a single switch-wide value otherwise.
+type FrameSizes struct {
+	Ports  map[string]float64
+	Global *float64
+}
+
+func (c *PortStatsCollector) refreshFrameSizes(ctx context.Context) {
+	sizes, err := fetchFrameSizes(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching MTU settings: %v", err)
+		return
+	}
+	sizes.Ports = truncateKeys(c, sizes.Ports)
+	c.frameSizes = sizes
+}
+
+func (c *PortStatsCollector) collectFrameSizes(ch chan<- prometheus.Metric) {
+	for name, mtu := range c.frameSizes.Ports {
+		ch <- c.constMetric(
+			c.portMTU, prometheus.GaugeValue,
+			mtu, name, c.portRole(name),
+		)
+	}
+	if c.frameSizes.Global != nil {
+		ch <- c.constMetric(
+			c.switchMaxFrame, prometheus.GaugeValue,
+			*c.frameSizes.Global,
+		)
+	}
+}
+
+func fetchFrameSizes(ctx context.Context, config Config) (FrameSizes, error) {
+	doc, err := fetchDocument(ctx, config, config.MTUPath)
+	if err != nil {
+		return FrameSizes{}, err
+	}
+
+	return parseFrameSizes(doc), nil
+}
+
+func isFrameSizeLabel(text string) bool {
+	text = strings.ToLower(text)
+	return strings.Contains(text, "mtu") || strings.Contains(text, "frame")
+}
+
+// parseFrameSizes reads per-port sizes from the column whose header mentions
+// MTU or frame size. Pages without such a column are searched for a
+// label/value row, as used by models with only a global jumbo frame setting.
+func parseFrameSizes(doc *goquery.Document) FrameSizes {
+	var sizes FrameSizes
+	mtuCol := -1
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		if headers := s.Find("th"); headers.Length() > 1 {
+			headers.EachWithBreak(func(j int, th *goquery.Selection) bool {
+				if j > 0 && isFrameSizeLabel(th.Text()) {
+					mtuCol = j
+					return false
+				}
+				return true
+			})
+			return
+		}
+
+		cells := s.Find("td")
+		name := strings.TrimSpace(cells.First().Text())
+		if mtuCol < 0 || name == "" || cells.Length() <= mtuCol {
+			return
+		}
+		if mtu, ok := parseNumber(cells.Eq(mtuCol).Text()); ok {
+			if sizes.Ports == nil {
+				sizes.Ports = map[string]float64{}
+			}
+			sizes.Ports[name] = mtu
+		}
+	})
+	if sizes.Ports != nil {
+		return sizes
+	}
+
+	eachLabeledRow(doc, func(label, text string) {
+		if sizes.Global != nil || !isFrameSizeLabel(label) {
+			return
+		}
+		// "Disable" and similar leave the size to the standard frame
+		if mtu, ok := parseNumber(text); ok {
+			sizes.Global = &mtu
+		}
+	})
+
+	return sizes
+}
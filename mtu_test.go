@@ -0,0 +1,47 @@
+package main
+
+import (
+	"maps"
+	"testing"
+)
+
+func TestParseFrameSizesPerPort(t *testing.T) {
+	sizes := parseFrameSizes(parseFixture(t, "mtu_ports.html"))
+	// Port 3 shows no size and is left out
+	want := map[string]float64{"Port 1": 9216, "Port 2": 1518}
+	if !maps.Equal(sizes.Ports, want) {
+		t.Errorf("got %v, want %v", sizes.Ports, want)
+	}
+	if sizes.Global != nil {
+		t.Errorf("got global size %v next to per-port sizes", *sizes.Global)
+	}
+}
+
+func TestParseFrameSizesGlobal(t *testing.T) {
+	sizes := parseFrameSizes(parseFixture(t, "mtu_global.html"))
+	if sizes.Ports != nil {
+		t.Errorf("got per-port sizes %v from a page without an MTU column", sizes.Ports)
+	}
+	if sizes.Global == nil || *sizes.Global != 9216 {
+		t.Errorf("got global size %v, want 9216", sizes.Global)
+	}
+}
+
+func TestFrameSizeMetrics(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+		"/port.cgi":            readFixture(t, "mtu_ports.html"),
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.MTUEnabled = true
+	}))
+
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_mtu_bytes{port="Port 1",role="unknown"} 9216`,
+		`port_mtu_bytes{port="Port 2",role="unknown"} 1518`,
+	)
+	if metricFamilyPresent(body, "switch_max_frame_bytes") {
+		t.Errorf("switch-wide size exported next to per-port sizes:\n%s", body)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// avgPacketSize divides the good bytes of a port by its good packets since
+// the counters were last cleared. It reports false without packets.
+func avgPacketSize(bytes, packets uint64) (float64, bool) {
+	if packets == 0 {
+		return 0, false
+	}
+	return float64(bytes) / float64(packets), true
+}
+
+func (c *PortStatsCollector) collectPacketSize(ch chan<- prometheus.Metric, port Port, labels []string) {
+	if size, ok := avgPacketSize(port.RxGoodBytes, port.RxGoodPkt); ok {
+		ch <- c.constMetric(
+			c.portRxAvgPacketSize, prometheus.GaugeValue, size, labels...,
+		)
+	}
+	if size, ok := avgPacketSize(port.TxGoodBytes, port.TxGoodPkt); ok {
+		ch <- c.constMetric(
+			c.portTxAvgPacketSize, prometheus.GaugeValue, size, labels...,
+		)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestAvgPacketSize(t *testing.T) {
+	tests := []struct {
+		bytes   uint64
+		packets uint64
+		want    float64
+		ok      bool
+	}{
+		{3000, 20, 150, true},
+		{64, 1, 64, true},
+		{1000, 3, 1000.0 / 3, true},
+		{0, 5, 0, true},
+		{0, 0, 0, false},
+		{5000, 0, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := avgPacketSize(tt.bytes, tt.packets)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("avgPacketSize(%d, %d) = %v, %v, want %v, %v", tt.bytes, tt.packets, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestAvgPacketSizeMetrics(t *testing.T) {
+	router, _, _ := newFakeRouter(testConfig(t, "192.168.1.1", nil))
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_rx_avg_packet_size_bytes{port="Port 1",role="unknown"} 150`,
+		`port_tx_avg_packet_size_bytes{port="Port 1",role="unknown"} 400`,
+	)
+	// Port 2 has not seen a packet
+	assertNotContains(t, body,
+		`port_rx_avg_packet_size_bytes{port="Port 2"`,
+		`port_tx_avg_packet_size_bytes{port="Port 2"`,
+	)
+}
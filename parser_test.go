@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func parseFixture(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(readFixture(t, name)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestParsePortStatistics(t *testing.T) {
+	stats, err := parsePortStatistics(parseFixture(t, "stats.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Port{
+		{Name: "Port 1", State: "Enable", LinkStatus: "Link Up", TxGoodPkt: 1523, RxGoodPkt: 2087, RxGoodBytes: 1<<32 + 1024, TxGoodBytes: 987654},
+		{Name: "Port 2", State: "Enable", LinkStatus: "Link Down"},
+		{Name: "Port 3", State: "Disable", LinkStatus: "Link Down", TxGoodPkt: 12, RxGoodPkt: 34, RxGoodBytes: 5600, TxGoodBytes: 7800},
+	}
+	if len(stats.Ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(stats.Ports), len(want), stats.Ports)
+	}
+	for i, port := range stats.Ports {
+		if port != want[i] {
+			t.Errorf("port %d: got %+v, want %+v", i, port, want[i])
+		}
+	}
+}
+
+func TestColumnMismatch(t *testing.T) {
+	tests := []struct {
+		fixture string
+		cells   int
+		want    float64
+	}{
+		{"stats.html", 0, 0},
+		{"stats.html", 7, 0},
+		{"stats_mismatch.html", 0, 3},
+		{"stats.html", 8, 3},
+	}
+	for _, tt := range tests {
+		before := testutil.ToFloat64(columnMismatches)
+		stats, err := parseStatsTable(parseFixture(t, tt.fixture), defaultTableSelector, defaultStatsColumns, tt.cells, "plain")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := testutil.ToFloat64(columnMismatches) - before; got != tt.want {
+			t.Errorf("%s with %d cells: got %v mismatched rows, want %v", tt.fixture, tt.cells, got, tt.want)
+		}
+		// Mismatched rows are still exported, the counter is the signal
+		if len(stats.Ports) != 3 {
+			t.Errorf("%s with %d cells: got %d ports", tt.fixture, tt.cells, len(stats.Ports))
+		}
+	}
+}
+
+func TestParsePortStatisticsJSON(t *testing.T) {
+	stats, err := parsePortStatisticsJSON([]byte(readFixture(t, "stats.json")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Port{
+		{Name: "Port 1", State: "Enable", LinkStatus: "Link Up", TxGoodPkt: 1523, RxGoodPkt: 2087, RxGoodBytes: 1<<32 + 1024, TxGoodBytes: 987654},
+		{Name: "Port 2", State: "1", LinkStatus: "0"},
+		{Name: "Port 3", State: "Disable", LinkStatus: "Link Down", TxGoodPkt: 12, RxGoodPkt: 34, RxGoodBytes: 5600, TxGoodBytes: 7800},
+	}
+	if len(stats.Ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(stats.Ports), len(want), stats.Ports)
+	}
+	for i, port := range stats.Ports {
+		if port != want[i] {
+			t.Errorf("port %d: got %+v, want %+v", i, port, want[i])
+		}
+	}
+
+	bare, err := parsePortStatisticsJSON([]byte(`[{"port": "Port 1", "tx_good_pkt": 5}, {"port": "  "}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bare.Ports) != 1 || bare.Ports[0].Name != "Port 1" || bare.Ports[0].TxGoodPkt != 5 {
+		t.Errorf("got %+v from a bare list", bare.Ports)
+	}
+
+	if _, err := parsePortStatisticsJSON([]byte(`{"port_statistics": [{"port": "Port 1", "tx_good_pkt": -1}]}`)); err == nil {
+		t.Error("negative counter accepted")
+	}
+}
+
+func TestParsePortStatisticsSkipsBlankRows(t *testing.T) {
+	stats, err := parsePortStatistics(parseFixture(t, "stats_blank_rows.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, port := range stats.Ports {
+		names = append(names, port.Name)
+	}
+	if want := []string{"Port 1", "Port 2", "Port 3"}; strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("got ports %q, want %q", names, want)
+	}
+}
+
+func TestParsePortStatisticsSkipsDecoyTables(t *testing.T) {
+	stats, err := parsePortStatistics(parseFixture(t, "stats_decoy_tables.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Port{
+		{Name: "Port 1", State: "Enable", LinkStatus: "Link Up", TxGoodPkt: 1523, RxGoodPkt: 2087, RxGoodBytes: 1<<32 + 1024, TxGoodBytes: 987654},
+		{Name: "Port 2", State: "Enable", LinkStatus: "Link Down"},
+	}
+	if len(stats.Ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(stats.Ports), len(want), stats.Ports)
+	}
+	for i, port := range stats.Ports {
+		if port != want[i] {
+			t.Errorf("port %d: got %+v, want %+v", i, port, want[i])
+		}
+	}
+
+	// An explicit table_selector is taken as it is
+	doc := parseFixture(t, "stats_decoy_tables.html")
+	stats, err = parseStatsTable(doc, "#footer tr", defaultStatsColumns, 0, "plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Ports) != 1 || stats.Ports[0].Name != "Firmware" {
+		t.Errorf("got %+v from the footer table", stats.Ports)
+	}
+}
+
+func TestParseStatValue(t *testing.T) {
+	tests := []struct {
+		value     string
+		separator string
+		want      uint64
+	}{
+		{"0", "", 0},
+		{" 1523 ", "", 1523},
+		{"1-1024", "", 1<<32 + 1024},
+		{"4294967295-4294967295", "", 1<<64 - 1},
+		{"4294967296-1", "", 0},
+		{"18446744073709551616", "", 0},
+		{"1,234,567", ",", 1234567},
+		{"1.234.567", ".", 1234567},
+		{"1,234", "", 0},
+		{"-5", "", 0},
+		{"", "", 0},
+	}
+	for _, tt := range tests {
+		if got := parseStatValue(tt.value, tt.separator); got != tt.want {
+			t.Errorf("parseStatValue(%q, %q) = %d, want %d", tt.value, tt.separator, got, tt.want)
+		}
+	}
+}
+
+func TestNumberFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		bytes  string
+	}{
+		{"plain", "1234567"},
+		{"comma_grouped", "1,234,567"},
+		{"dot_grouped", "1.234.567"},
+	}
+	for _, tt := range tests {
+		page := `<table><tr><th>Port</th><th>State</th><th>Link Status</th><th>TxGoodPkt</th><th>RxGoodPkt</th><th>RxGoodBytes</th><th>TxGoodBytes</th></tr>` +
+			`<tr><td>Port 1</td><td>Enable</td><td>Link Up</td><td>1</td><td>2</td><td>` + tt.bytes + `</td><td>` + tt.bytes + `</td></tr></table>`
+		sw := newFakeSwitch(t, map[string]string{"/port.cgi?page=stats": page})
+		config := testConfig(t, sw.Address(), func(c *Config) { c.NumberFormat = tt.format })
+		stats, err := fetchPortStatistics(context.Background(), config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if port := stats.Ports[0]; port.RxGoodBytes != 1234567 || port.TxGoodBytes != 1234567 {
+			t.Errorf("%s: got %d and %d bytes from %s", tt.format, port.RxGoodBytes, port.TxGoodBytes, tt.bytes)
+		}
+	}
+
+	config := Config{Address: "192.168.1.1", NumberFormat: "space_grouped"}
+	applyDefaults(&config)
+	if err := validateConfig(config); err == nil {
+		t.Error("unknown number_format accepted")
+	}
+}
+
+// FuzzParsePortStatistics feeds arbitrary pages to the stats parsers, which
+// must neither panic nor make up ports the page has no rows for.
+func FuzzParsePortStatistics(f *testing.F) {
+	for _, name := range []string{"stats.html", "login.html"} {
+		f.Add([]byte(readFixture(f, name)))
+	}
+	f.Add([]byte(`<table><tr><td>Port</td></tr><tr></tr><tr><td></td></tr></table>`))
+	f.Add([]byte(`<table><tr><th>Port</th></tr><tr><td>Port 1</td><td>Enable</td><td>Link Up</td><td>99999999999999999999</td></tr></table>`))
+	f.Add([]byte(`<td>Port 1<td>Enable<td>Link Up<td>1-2-3<td>-<td>4294967296-0`))
+	f.Add([]byte(`{"port_statistics": [{"port": "Port 1", "tx_good_pkt": 1e30}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := goquery.NewDocumentFromReader(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		rows := doc.Find("tr").Length()
+		for _, format := range []string{"plain", "comma_grouped"} {
+			stats, err := parseStatsTable(doc, defaultTableSelector, defaultStatsColumns, 0, format)
+			if err != nil {
+				continue
+			}
+			if len(stats.Ports) > rows {
+				t.Errorf("got %d ports from %d rows", len(stats.Ports), rows)
+			}
+			for _, port := range stats.Ports {
+				if port.Name == "" || port.Name != strings.TrimSpace(port.Name) {
+					t.Errorf("got port name %q", port.Name)
+				}
+			}
+		}
+		parsePortStatisticsJSON(data)
+	})
+}
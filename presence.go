@@ -0,0 +1,81 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// updatePresence records the fetch time for every port in stats.
+func (c *PortStatsCollector) updatePresence(stats PortStatistics, now time.Time) {
+	if c.portLastSeen == nil {
+		c.portLastSeen = make(map[string]time.Time, len(stats.Ports))
+	}
+	for _, port := range stats.Ports {
+		c.portLastSeen[port.Name] = now
+	}
+}
+
+// evictPorts forgets the ports missing from the statistics for longer than
+// PortAbsentGrace in the per-port maps that outlive a fetch, so names from
+// a misparse or renamed ports do not pile up, and updates trackedPorts.
+func (c *PortStatsCollector) evictPorts(now time.Time) {
+	grace := time.Duration(c.config.PortAbsentGrace) * time.Second
+	for name, seen := range c.portLastSeen {
+		if now.Sub(seen) > grace {
+			delete(c.portLastSeen, name)
+		}
+	}
+	for name := range c.saturationEvents {
+		if _, ok := c.portLastSeen[name]; !ok {
+			delete(c.saturationEvents, name)
+		}
+	}
+	for name := range c.counterTotals {
+		if _, ok := c.portLastSeen[name]; !ok {
+			delete(c.counterTotals, name)
+			delete(c.counterRaw, name)
+		}
+	}
+
+	for name, size := range map[string]int{
+		"samples":           len(c.samples),
+		"utilization":       len(c.utilization),
+		"utilization_ema":   len(c.utilizationEMA),
+		"saturation_events": len(c.saturationEvents),
+		"smoothed":          len(c.smoothed),
+		"counter_totals":    len(c.counterTotals),
+		"counter_raw":       len(c.counterRaw),
+		"last_seen":         len(c.portLastSeen),
+	} {
+		c.trackedPorts.WithLabelValues(name).Set(float64(size))
+	}
+}
+
+// collectPresence exports when each port was last reported by the switch.
+// Ports missing from stats keep being exported with port_present 0 for
+// PortAbsentGrace, then are forgotten.
+func (c *PortStatsCollector) collectPresence(ch chan<- prometheus.Metric, stats PortStatistics) {
+	present := make(map[string]bool, len(stats.Ports))
+	for _, port := range stats.Ports {
+		present[port.Name] = true
+	}
+	grace := time.Duration(c.config.PortAbsentGrace) * time.Second
+
+	for name, seen := range c.portLastSeen {
+		if !present[name] && time.Since(seen) > grace {
+			delete(c.portLastSeen, name)
+			continue
+		}
+
+		labels := []string{name, c.portRole(name)}
+		ch <- c.constMetric(
+			c.portLastSeenTime, prometheus.GaugeValue,
+			float64(seen.UnixNano())/1e9, labels...,
+		)
+		ch <- c.constMetric(
+			c.portPresent, prometheus.GaugeValue,
+			boolToFloat(present[name]), labels...,
+		)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// rewind moves the fetch history of c back by d, as if that much time had
+// passed, so the next scrape fetches again.
+func rewind(c *PortStatsCollector, d time.Duration) {
+	c.lastSuccess = c.lastSuccess.Add(-d)
+	for name, seen := range c.portLastSeen {
+		c.portLastSeen[name] = seen.Add(-d)
+	}
+}
+
+func TestPortAbsentGraceDefault(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", func(c *Config) { c.PollRate = 15 })
+	if config.PortAbsentGrace != 45 {
+		t.Errorf("got port_absent_grace_seconds %d, want three poll intervals", config.PortAbsentGrace)
+	}
+}
+
+func TestVanishedPort(t *testing.T) {
+	router, collector, fetcher := newFakeRouter(testConfig(t, "192.168.1.1", func(c *Config) {
+		c.CountersResetOnRead = true
+	}))
+	get(t, router, "/metrics")
+
+	// Port 2 misses a fetch and is reported absent, keeping its totals
+	fetcher.Set(PortStatistics{Ports: testPorts().Ports[:1]}, nil)
+	rewind(collector, 10*time.Second)
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_present{port="Port 1",role="unknown"} 1`,
+		`port_present{port="Port 2",role="unknown"} 0`,
+	)
+	if _, ok := collector.counterTotals["Port 2"]; !ok {
+		t.Error("running totals of Port 2 dropped after a single missed fetch")
+	}
+
+	// Past the grace it is forgotten
+	rewind(collector, 31*time.Second)
+	_, body = get(t, router, "/metrics")
+	if metricValue(t, body, `port_present{port="Port 1",role="unknown"}`) != 1 {
+		t.Error("Port 1 not present")
+	}
+	if _, ok := collector.counterTotals["Port 2"]; ok {
+		t.Error("running totals of Port 2 kept past the grace")
+	}
+	if n := testutil.ToFloat64(collector.trackedPorts.WithLabelValues("last_seen")); n != 1 {
+		t.Errorf("tracking %v ports, want 1", n)
+	}
+	assertNotContains(t, body, `port_present{port="Port 2"`)
+}
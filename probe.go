@@ -0,0 +1,115 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// probeHandler scrapes the switch given by the target parameter, in the
+// style of the blackbox exporter. The optional module parameter selects a
+// named block from the modules config whose fields override the top-level
+// config for this probe. Targets outside probe_targets are refused, as the
+// probe would send them the switch credentials.
+func probeHandler(config Config) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		target := params.Get("target")
+		if target == "" {
+			http.Error(w, "Target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		probeConfig := config
+		if name := params.Get("module"); name != "" {
+			module, ok := config.Modules[name]
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown module %q", name), http.StatusBadRequest)
+				return
+			}
+			var err error
+			probeConfig, err = config.withModule(module)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid module %q: %v", name, err), http.StatusBadRequest)
+				return
+			}
+		}
+		probeConfig.Address = target
+		// The request slots of a switch are shared with every other
+		// request to it, so their number comes from the top-level config
+		probeConfig.MaxSwitchRequests = config.MaxSwitchRequests
+		applyDefaults(&probeConfig)
+		if !probeTargetAllowed(config.ProbeTargets, probeConfig.Address) {
+			http.Error(w, fmt.Sprintf("Target %q is not in probe_targets", target), http.StatusForbidden)
+			return
+		}
+		if err := validateConfig(probeConfig); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid probe configuration: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		registry := prometheus.NewRegistry()
+		collector := NewPortStatsCollector(probeConfig, registry)
+		registry.MustRegister(scrapeCollector{collector, scrapeTimeout(r)})
+
+		promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}).ServeHTTP(w, r)
+	})
+}
+
+// probeTargetAllowed reports whether the host of address is listed in
+// targets, either by name or by a CIDR containing it. Any port is allowed.
+func probeTargetAllowed(targets []string, address string) bool {
+	u, err := url.Parse("http://" + address)
+	if err != nil || u.Hostname() == "" {
+		return false
+	}
+	host := u.Hostname()
+	addr, addrErr := netip.ParseAddr(host)
+	for _, target := range targets {
+		if prefix, err := netip.ParsePrefix(target); err == nil {
+			if addrErr == nil && prefix.Contains(addr.Unmap()) {
+				return true
+			}
+			continue
+		}
+		if target, err := netip.ParseAddr(target); err == nil {
+			if addrErr == nil && target.Unmap() == addr.Unmap() {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(target, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateProbe(config Config) error {
+	if config.WebUsername == "" || config.WebPassword == "" {
+		return errors.New("enable_probe requires web_username and web_password")
+	}
+	if len(config.ProbeTargets) == 0 {
+		return errors.New("enable_probe requires probe_targets")
+	}
+	for _, target := range config.ProbeTargets {
+		if _, err := netip.ParsePrefix(target); err == nil {
+			continue
+		}
+		if _, err := netip.ParseAddr(target); err == nil {
+			continue
+		}
+		if strings.ContainsAny(target, ":/") || validateAddress(target) != nil {
+			return fmt.Errorf("invalid probe_targets entry %q: want a host, IP address or CIDR", target)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func probeConfig(t *testing.T, targets ...string) Config {
+	return testConfig(t, "192.168.1.1", func(c *Config) {
+		c.EnableProbe = true
+		c.ProbeTargets = targets
+		c.WebUsername = "prometheus"
+		c.WebPassword = "scrape"
+	})
+}
+
+// getAuth requests path from handler with the web credentials of config.
+func getAuth(t *testing.T, handler http.Handler, config Config, path string) (int, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.SetBasicAuth(config.WebUsername, config.WebPassword)
+	handler.ServeHTTP(recorder, request)
+	return recorder.Code, recorder.Body.String()
+}
+
+func TestProbeDisabledByDefault(t *testing.T) {
+	router, _ := newTestRouter(testConfig(t, "192.168.1.1", nil))
+	if code, _ := get(t, router, "/probe?target=127.0.0.1"); code != http.StatusNotFound {
+		t.Errorf("got status %d, want /probe to be unregistered", code)
+	}
+}
+
+func TestProbe(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	config := probeConfig(t, "127.0.0.0/8")
+	router, _ := newTestRouter(config)
+
+	if code, _ := get(t, router, "/probe?target="+sw.Address()); code != http.StatusUnauthorized {
+		t.Errorf("got status %d without web credentials, want 401", code)
+	}
+	code, body := getAuth(t, router, config, "/probe?target="+sw.Address())
+	if code != http.StatusOK {
+		t.Fatalf("got status %d: %s", code, body)
+	}
+	assertContains(t, body, `port_state{port="Port 1",role="unknown"} 1`)
+
+	code, _ = getAuth(t, router, config, "/probe?target=10.0.0.1")
+	if code != http.StatusForbidden {
+		t.Errorf("got status %d for a target outside probe_targets, want 403", code)
+	}
+	if n := len(sw.Requests()); n != 1 {
+		t.Errorf("got %d requests to the switch, want 1", n)
+	}
+}
+
+func TestProbeModuleSwitchRequests(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=stats": readFixture(t, "stats.html"),
+	})
+	config, err := readConfigFrom(strings.NewReader("modules:\n  busy:\n    max_switch_requests: 3\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	probe := probeConfig(t, "127.0.0.0/8")
+	probe.Modules = config.Modules
+	router, _ := newTestRouter(probe)
+
+	for _, path := range []string{"/probe?target=", "/probe?module=busy&target="} {
+		if code, body := getAuth(t, router, probe, path+sw.Address()); code != http.StatusOK {
+			t.Fatalf("%s: got status %d: %s", path, code, body)
+		}
+		switchSlots.Lock()
+		slots := cap(switchSlots.byAddress[sw.Address()])
+		switchSlots.Unlock()
+		if slots != 1 {
+			t.Errorf("%s: got %d request slots, want max_switch_requests of the top-level config", path, slots)
+		}
+	}
+}
+
+func TestProbeTargetAllowed(t *testing.T) {
+	targets := []string{"192.168.1.0/24", "10.0.0.5", "Core-Switch.lan", "fd00::/64"}
+	tests := []struct {
+		address string
+		want    bool
+	}{
+		{"192.168.1.20", true},
+		{"192.168.1.20:8080", true},
+		{"192.168.2.1", false},
+		{"10.0.0.5", true},
+		{"10.0.0.6", false},
+		{"core-switch.lan", true},
+		{"core-switch.lan.evil.example", false},
+		{"[fd00::1]:80", true},
+		{"metadata.internal", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := probeTargetAllowed(targets, tt.address); got != tt.want {
+			t.Errorf("probeTargetAllowed(%q) = %v, want %v", tt.address, got, tt.want)
+		}
+	}
+}
+
+func TestValidateProbe(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(*Config)
+	}{
+		{"no web auth", func(c *Config) { c.WebUsername, c.WebPassword = "", "" }},
+		{"no targets", func(c *Config) { c.ProbeTargets = nil }},
+		{"target with port", func(c *Config) { c.ProbeTargets = []string{"switch.lan:80"} }},
+		{"target URL", func(c *Config) { c.ProbeTargets = []string{"http://switch.lan"} }},
+	}
+	for _, tt := range tests {
+		config := probeConfig(t, "192.168.1.0/24")
+		tt.edit(&config)
+		if err := validateConfig(config); err == nil {
+			t.Errorf("%s: configuration accepted", tt.name)
+		}
+	}
+}
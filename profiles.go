@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// modelProfile is the known stats page layout of a switch model, selected
+// with the model config field. Empty fields keep the configured values.
+type modelProfile struct {
+	StatsPath     string
+	TableSelector string
+	Columns       map[string]int
+}
+
+// modelProfiles are the built-in layouts by model name. Add a model here
+// once its stats page has been checked against the switch.
+var modelProfiles = map[string]modelProfile{
+	"xikestor-sks3200-8e1x": {
+		StatsPath:     defaultStatsPath,
+		TableSelector: defaultTableSelector,
+		Columns:       defaultStatsColumns,
+	},
+}
+
+// applyModelProfile fills in the stats page settings of the configured
+// model that were not set explicitly. It runs before the defaults.
+func applyModelProfile(config *Config) {
+	profile, ok := modelProfiles[config.Model]
+	if !ok {
+		return
+	}
+	if config.StatsPath == "" {
+		config.StatsPath = profile.StatsPath
+	}
+	if config.TableSelector == "" {
+		config.TableSelector = profile.TableSelector
+	}
+}
+
+// statsColumns returns the column layout of the stats page.
+func statsColumns(config Config) map[string]int {
+	if profile, ok := modelProfiles[config.Model]; ok && profile.Columns != nil {
+		return profile.Columns
+	}
+	return defaultStatsColumns
+}
+
+func validateModel(model string) error {
+	if model == "" {
+		return nil
+	}
+	if _, ok := modelProfiles[model]; !ok {
+		models := slices.Sorted(maps.Keys(modelProfiles))
+		return fmt.Errorf("unknown model %q, known models: %s", model, strings.Join(models, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+// TestModelProfiles checks every profile against the stats page of its
+// model.
+func TestModelProfiles(t *testing.T) {
+	tests := []struct {
+		model string
+		stats string
+		ports int
+	}{
+		{"xikestor-sks3200-8e1x", "stats.html", 3},
+	}
+	for _, tt := range tests {
+		profile, ok := modelProfiles[tt.model]
+		if !ok {
+			t.Fatalf("no profile %s", tt.model)
+		}
+		sw := newFakeSwitch(t, map[string]string{profile.StatsPath: readFixture(t, tt.stats)})
+		config := testConfig(t, sw.Address(), func(c *Config) { c.Model = tt.model })
+
+		stats, err := fetchPortStatistics(context.Background(), config)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.model, err)
+		}
+		if len(stats.Ports) != tt.ports {
+			t.Errorf("%s: got %d ports, want %d", tt.model, len(stats.Ports), tt.ports)
+		}
+	}
+	if len(tests) != len(modelProfiles) {
+		t.Errorf("got fixtures for %d of %d profiles", len(tests), len(modelProfiles))
+	}
+}
+
+func TestValidateModel(t *testing.T) {
+	for _, model := range []string{"", "xikestor-sks3200-8e1x"} {
+		if err := validateModel(model); err != nil {
+			t.Errorf("model %q: %v", model, err)
+		}
+	}
+	// Not built in until its stats page has been checked
+	for _, model := range []string{"auto", "sodola-sl-swtg3c8f"} {
+		if err := validateModel(model); err == nil {
+			t.Errorf("model %q accepted", model)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// repeatLogger logs an identical message at most once per interval,
+// counting the repeats in between and reporting them with the next line.
+// It is not safe for concurrent use.
+type repeatLogger struct {
+	interval   time.Duration
+	last       string
+	loggedAt   time.Time
+	suppressed int
+}
+
+func (l *repeatLogger) Printf(format string, v ...any) {
+	message := fmt.Sprintf(format, v...)
+	now := time.Now()
+	if message == l.last && now.Sub(l.loggedAt) < l.interval {
+		l.suppressed++
+		return
+	}
+
+	if message != l.last {
+		l.Flush()
+		log.Print(message)
+	} else if l.suppressed > 0 {
+		log.Printf("%s (repeated %d times in %s)", message, l.suppressed+1, now.Sub(l.loggedAt).Round(time.Second))
+	} else {
+		log.Print(message)
+	}
+	l.last = message
+	l.loggedAt = now
+	l.suppressed = 0
+}
+
+// Flush reports repeats suppressed since the last line and forgets the
+// message, so it is logged again right away if it comes back.
+func (l *repeatLogger) Flush() {
+	if l.suppressed > 0 {
+		log.Printf("%s (repeated %d more times)", l.last, l.suppressed)
+	}
+	l.last = ""
+	l.suppressed = 0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	configReloadSuccess = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "exporter_config_last_reload_success",
+		Help: "Whether the last configuration reload succeeded",
+	})
+	configReloadTimestamp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "exporter_config_last_reload_timestamp_seconds",
+		Help: "Timestamp of the last configuration reload attempt",
+	})
+)
+
+// loadConfig reads the config file and optional .env file and fills in the
+// defaults.
+func loadConfig(configFile, envFile string) (Config, error) {
+	config, err := readConfig(configFile)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading configuration: %w", err)
+	}
+	if envFile != "" {
+		if err := applyEnvFile(envFile, &config); err != nil {
+			return Config{}, fmt.Errorf("error reading env file: %w", err)
+		}
+	}
+
+	applyDefaults(&config)
+	if err := validateConfig(config); err != nil {
+		return Config{}, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return config, nil
+}
+
+// swapHandler serves the most recently stored handler, so a reload can
+// replace every route at once without restarting the server.
+type swapHandler struct {
+	handler atomic.Pointer[http.Handler]
+}
+
+func (s *swapHandler) Store(h http.Handler) {
+	s.handler.Store(&h)
+}
+
+func (s *swapHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	(*s.handler.Load()).ServeHTTP(w, r)
+}
+
+// reloader applies a changed configuration to the running exporter, on
+// SIGHUP or POST /-/reload.
+type reloader struct {
+	configFile    string
+	envFile       string
+	telemetryPath string
+	collector     *PortStatsCollector
+	discovered    *discovery
+	handler       *swapHandler
+	// config is the configuration in effect
+	config Config
+
+	// One reload at a time, signals and requests may overlap
+	mutex sync.Mutex
+}
+
+// Reload re-reads the configuration and applies it. A broken config is
+// logged and returned, and the running one kept.
+func (r *reloader) Reload() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	configReloadTimestamp.SetToCurrentTime()
+
+	if r.configFile == "-" {
+		configReloadSuccess.Set(0)
+		log.Printf("Configuration was read from stdin and cannot be reloaded, restart the exporter instead")
+		return errors.New("configuration was read from stdin and cannot be reloaded")
+	}
+
+	config, err := loadConfig(r.configFile, r.envFile)
+	if err == nil {
+		err = checkReloadable(r.config, config)
+	}
+	if err != nil {
+		configReloadSuccess.Set(0)
+		log.Printf("Error reloading configuration, keeping the current one: %v", err)
+		return err
+	}
+
+	r.collector.Reload(config)
+	if r.discovered != nil {
+		r.discovered.Reload(config)
+	}
+	r.handler.Store(newRouter(config, r))
+	r.config = config
+	configReloadSuccess.Set(1)
+	log.Printf("Configuration reloaded from %s", r.configFile)
+	return nil
+}
+
+// reloadHandler reloads the configuration on POST, answering 400 with the
+// error if it is broken.
+func reloadHandler(reload *reloader) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if err := reload.Reload(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+// checkReloadable rejects changes to the settings the metric descriptions
+// and the self-metrics are built from at startup, which a reload cannot
+// apply.
+func checkReloadable(running, config Config) error {
+	if !maps.Equal(running.Labels, config.Labels) {
+		return errors.New("labels cannot change on reload, restart the exporter instead")
+	}
+	if !maps.Equal(running.MetricOverrides, config.MetricOverrides) {
+		return errors.New("metric_overrides cannot change on reload, restart the exporter instead")
+	}
+	if running.MinimalMetrics != config.MinimalMetrics {
+		return errors.New("minimal_metrics cannot change on reload, restart the exporter instead")
+	}
+	return nil
+}
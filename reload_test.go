@@ -0,0 +1,130 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestReloader loads the configuration in content from a file, as main
+// does, and returns a reloader for it along with the file path.
+func newTestReloader(t *testing.T, content string) (*reloader, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, content)
+	config, err := loadConfig(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reload := &reloader{
+		configFile:    path,
+		telemetryPath: "/metrics",
+		collector:     NewPortStatsCollector(config, prometheus.NewRegistry()),
+		handler:       &swapHandler{},
+		config:        config,
+	}
+	reload.handler.Store(newRouter(config, reload))
+	return reload, path
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReloadRejectsMetricDescriptionChanges(t *testing.T) {
+	const base = "address: 192.168.1.1\nusername: admin\npassword: secret\n"
+	reload, path := newTestReloader(t, base+"labels:\n  rack: a1\n")
+
+	for name, content := range map[string]string{
+		"labels":           base + "labels:\n  rack: b2\n",
+		"metric_overrides": base + "labels:\n  rack: a1\nmetric_overrides:\n  port_state:\n    name: switch_port_state\n",
+		"minimal_metrics":  base + "labels:\n  rack: a1\nminimal_metrics: true\n",
+	} {
+		writeFile(t, path, content)
+		if err := reload.Reload(); err == nil {
+			t.Errorf("reload changing %s accepted", name)
+		}
+		if v := testutil.ToFloat64(configReloadSuccess); v != 0 {
+			t.Errorf("%s: got exporter_config_last_reload_success %v, want 0", name, v)
+		}
+		if rack := reload.collector.config.Labels["rack"]; rack != "a1" {
+			t.Errorf("%s: collector switched to label rack=%q", name, rack)
+		}
+	}
+
+	// Other settings still reload
+	writeFile(t, path, base+"labels:\n  rack: a1\nport_roles:\n  Port 1: uplink\n")
+	if err := reload.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if role := reload.collector.portRole("Port 1"); role != "uplink" {
+		t.Errorf("got role %q after the reload, want uplink", role)
+	}
+}
+
+func TestReloadSuccessToggles(t *testing.T) {
+	const valid = "address: 192.168.1.1\nusername: admin\npassword: secret\n"
+	reload, path := newTestReloader(t, valid)
+
+	steps := []struct {
+		content string
+		success float64
+	}{
+		{valid + "poll_rate_seconds: 30\n", 1},
+		{valid + "poll_rate_seconds: [\n", 0},
+		{valid + "collect_mode: carrier-pigeon\n", 0},
+		{valid + "poll_rate_seconds: 20\n", 1},
+	}
+	for i, step := range steps {
+		writeFile(t, path, step.content)
+		before := testutil.ToFloat64(configReloadTimestamp)
+		err := reload.Reload()
+		if (err == nil) != (step.success == 1) {
+			t.Errorf("step %d: got error %v", i, err)
+		}
+		if v := testutil.ToFloat64(configReloadSuccess); v != step.success {
+			t.Errorf("step %d: got exporter_config_last_reload_success %v, want %v", i, v, step.success)
+		}
+		if after := testutil.ToFloat64(configReloadTimestamp); after < before || after == 0 {
+			t.Errorf("step %d: reload timestamp not updated", i)
+		}
+	}
+	// The broken files left the last good configuration running
+	if rate := reload.collector.config.PollRate; rate != 20 {
+		t.Errorf("got poll rate %d, want 20", rate)
+	}
+}
+
+func TestReloadFromStdin(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", nil)
+	router, collector := newTestRouter(config)
+	reload := &reloader{
+		configFile:    "-",
+		telemetryPath: "/metrics",
+		collector:     collector,
+		handler:       &swapHandler{},
+		config:        config,
+	}
+	reload.handler.Store(router)
+	configReloadSuccess.Set(1)
+	configReloadTimestamp.Set(0)
+
+	if err := reload.Reload(); err == nil {
+		t.Fatal("reload of a configuration read from stdin succeeded")
+	}
+	if v := testutil.ToFloat64(configReloadSuccess); v != 0 {
+		t.Errorf("got exporter_config_last_reload_success %v, want 0", v)
+	}
+	if v := testutil.ToFloat64(configReloadTimestamp); v == 0 {
+		t.Error("failed reload attempt left no timestamp")
+	}
+	if collector.config.Address != "192.168.1.1" {
+		t.Errorf("configuration replaced: %+v", collector.config)
+	}
+}
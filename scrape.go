@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// scrapeTimeoutOffset is kept free of the Prometheus scrape timeout so the
+// response still arrives in time.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// scrapeCollector passes the deadline of one scrape request to the
+// collector.
+type scrapeCollector struct {
+	collector *PortStatsCollector
+	timeout   time.Duration
+}
+
+func (s scrapeCollector) Describe(ch chan<- *prometheus.Desc) {
+	s.collector.Describe(ch)
+}
+
+func (s scrapeCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	s.collector.collect(ctx, ch)
+}
+
+// scrapeTimeout returns the timeout Prometheus announces in the
+// X-Prometheus-Scrape-Timeout-Seconds header minus scrapeTimeoutOffset, or
+// 0 when the header is missing. Requests to the switch are then bounded by
+// the configured timeout alone.
+func scrapeTimeout(r *http.Request) time.Duration {
+	header := r.Header.Get("X-Prometheus-Scrape-Timeout-Seconds")
+	if header == "" {
+		return 0
+	}
+	seconds, err := strconv.ParseFloat(header, 64)
+	if err != nil || seconds <= 0 {
+		return 0
+	}
+
+	timeout := time.Duration(seconds*float64(time.Second)) - scrapeTimeoutOffset
+	if timeout <= 0 {
+		timeout = time.Duration(seconds * float64(time.Second))
+	}
+	return timeout
+}
+
+// runOneshot scrapes the switch once and writes the switch metrics to
+// stdout. It returns the exit code, 1 if the switch could not be scraped.
+func runOneshot(collector *PortStatsCollector) int {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(scrapeCollector{collector: collector})
+	families, err := registry.Gather()
+	if err != nil {
+		log.Printf("Error gathering metrics: %v", err)
+		return 1
+	}
+
+	encoder := expfmt.NewEncoder(os.Stdout, expfmt.NewFormat(expfmt.TypeTextPlain))
+	for _, family := range families {
+		if err := encoder.Encode(family); err != nil {
+			log.Printf("Error writing metrics: %v", err)
+			return 1
+		}
+	}
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+	if collector.up() == 0 {
+		return 1
+	}
+	return 0
+}
+
+// metricsHandler serves the default registry together with collector and
+// the switches found by discovered (nil without discovery), bounded by the
+// scrape timeout of each request. With minimal_metrics only the switch
+// metrics are served, and with a port parameter only the series of that
+// port.
+func metricsHandler(collector *PortStatsCollector, discovered *discovery) http.Handler {
+	config := collector.Config()
+	minimal := config.MinimalMetrics
+	// Without an address only discovered switches are scraped
+	configured := config.Address != ""
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timeout := scrapeTimeout(r)
+		registry := prometheus.NewRegistry()
+		if configured {
+			registry.MustRegister(scrapeCollector{collector, timeout})
+		}
+
+		gatherers := prometheus.Gatherers{registry}
+		if !minimal {
+			gatherers = append(gatherers, prometheus.DefaultGatherer)
+		}
+		if discovered != nil {
+			// A registry of their own, their target label differs from
+			// the configured switch
+			targets := prometheus.NewRegistry()
+			for _, c := range discovered.Collectors() {
+				targets.MustRegister(scrapeCollector{c, timeout})
+			}
+			gatherers = append(gatherers, targets)
+			if !minimal {
+				gatherers = append(gatherers, discovered.registry)
+			}
+		}
+		var gatherer prometheus.Gatherer = gatherers
+		if query := r.URL.Query(); query.Has("port") {
+			gatherer = portGatherer{gatherers, query.Get("port")}
+		}
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{
+			EnableOpenMetrics: true,
+		}).ServeHTTP(w, r)
+	})
+	if minimal {
+		return handler
+	}
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, handler)
+}
+
+// portGatherer passes on only the series of one port, those whose port
+// label is port, for GET /metrics?port=.
+type portGatherer struct {
+	gatherer prometheus.Gatherer
+	port     string
+}
+
+func (g portGatherer) Gather() ([]*dto.MetricFamily, error) {
+	families, err := g.gatherer.Gather()
+	filtered := families[:0]
+	for _, family := range families {
+		metrics := family.Metric[:0]
+		for _, metric := range family.Metric {
+			for _, label := range metric.Label {
+				if label.GetName() == "port" && label.GetValue() == g.port {
+					metrics = append(metrics, metric)
+					break
+				}
+			}
+		}
+		if len(metrics) > 0 {
+			family.Metric = metrics
+			filtered = append(filtered, family)
+		}
+	}
+	return filtered, err
+}
+
+// limitInFlight answers 503 Service Unavailable to requests beyond the
+// first limit running at the same time.
+func limitInFlight(limit int, next http.Handler) http.Handler {
+	inFlight := make(chan struct{}, limit)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case inFlight <- struct{}{}:
+			defer func() { <-inFlight }()
+			next.ServeHTTP(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("Limit of %d concurrent requests reached", limit), http.StatusServiceUnavailable)
+		}
+	})
+}
+
+var landingPage = template.Must(template.New("landing").Parse(`<html>
+<head><title>Cheap Switch Exporter</title></head>
+<body>
+<h1>Cheap Switch Exporter</h1>
+<p><a href="{{.}}">Metrics</a></p>
+<p><a href="/targets">Targets</a></p>
+</body>
+</html>
+`))
+
+// landingHandler serves a short index page linking to the metrics path.
+func landingHandler(telemetryPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		landingPage.Execute(w, telemetryPath)
+	})
+}
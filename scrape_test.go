@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+func TestLimitInFlight(t *testing.T) {
+	const limit = 2
+	started := make(chan struct{})
+	release := make(chan struct{})
+	handler := limitInFlight(limit, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+
+	var wg sync.WaitGroup
+	codes := make(chan int, limit)
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			code, _ := get(t, handler, "/metrics")
+			codes <- code
+		}()
+	}
+	for range limit {
+		<-started
+	}
+
+	for range 3 {
+		if code, _ := get(t, handler, "/metrics"); code != http.StatusServiceUnavailable {
+			t.Errorf("got status %d beyond the limit, want 503", code)
+		}
+	}
+
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("got status %d within the limit", code)
+		}
+	}
+
+	go func() { <-started }()
+	if code, _ := get(t, handler, "/metrics"); code != http.StatusOK {
+		t.Errorf("got status %d once the requests finished", code)
+	}
+}
+
+func TestMetricsPortFilter(t *testing.T) {
+	router, _, _ := newFakeRouter(testConfig(t, "192.168.1.1", nil))
+
+	_, body := get(t, router, "/metrics?port=Port+2")
+	assertContains(t, body,
+		`port_state{port="Port 2",role="unknown"} 1`,
+		`port_link_status{port="Port 2",role="unknown"} 0`,
+	)
+	assertNotContains(t, body, `port="Port 1"`)
+	for _, family := range []string{"switch_up", "go_goroutines"} {
+		if metricFamilyPresent(body, family) {
+			t.Errorf("%s served for a single port", family)
+		}
+	}
+
+	_, body = get(t, router, "/metrics?port=Port+9")
+	assertNotContains(t, body, `port="`)
+
+	_, body = get(t, router, "/metrics")
+	assertContains(t, body,
+		`switch_up 1`,
+		`port_state{port="Port 1",role="unknown"} 1`,
+		`port_state{port="Port 2",role="unknown"} 1`,
+	)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Sessions holds the web session slots in use and available on the switch.
+// Readings the firmware does not report are left nil.
+type Sessions struct {
+	Active *float64
+	Max    *float64
+}
+
+func (c *PortStatsCollector) refreshSessions(ctx context.Context) {
+	sessions, err := fetchSessions(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching web sessions: %v", err)
+		return
+	}
+	c.sessions = sessions
+}
+
+func (c *PortStatsCollector) collectSessions(ch chan<- prometheus.Metric) {
+	sessions := c.sessions
+
+	if sessions.Active != nil {
+		ch <- c.constMetric(
+			c.switchSessions, prometheus.GaugeValue, *sessions.Active,
+		)
+	}
+	if sessions.Max != nil {
+		ch <- c.constMetric(
+			c.switchMaxSessions, prometheus.GaugeValue, *sessions.Max,
+		)
+	}
+}
+
+func fetchSessions(ctx context.Context, config Config) (Sessions, error) {
+	doc, err := fetchDocument(ctx, config, config.SessionsPath)
+	if err != nil {
+		return Sessions{}, err
+	}
+
+	return parseSessions(doc), nil
+}
+
+// parseSessions reads the rows whose label mentions sessions: "Max
+// Sessions: 4" or "Session Limit: 4" is the limit, any other, e.g.
+// "Active Sessions: 2", the slots in use. A "2/4" value carries both.
+func parseSessions(doc *goquery.Document) Sessions {
+	var sessions Sessions
+
+	eachLabeledRow(doc, func(label, text string) {
+		label = strings.ToLower(label)
+		if !strings.Contains(label, "session") {
+			return
+		}
+
+		if used, total, found := strings.Cut(text, "/"); found {
+			active, ok1 := parseNumber(used)
+			limit, ok2 := parseNumber(total)
+			if ok1 && ok2 && sessions.Active == nil {
+				sessions.Active, sessions.Max = &active, &limit
+			}
+			return
+		}
+		value, ok := parseNumber(text)
+		if !ok {
+			return
+		}
+		switch {
+		case strings.Contains(label, "max") || strings.Contains(label, "limit"):
+			if sessions.Max == nil {
+				sessions.Max = &value
+			}
+		case sessions.Active == nil:
+			sessions.Active = &value
+		}
+	})
+
+	return sessions
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func TestParseSessions(t *testing.T) {
+	tests := []struct {
+		name        string
+		page        string
+		active, max float64
+		hasActive   bool
+		hasMax      bool
+	}{
+		{"fixture", readFixture(t, "sessions.html"), 2, 4, true, true},
+		{"used/limit", `<table><tr><td>Web Sessions</td><td>1/4</td></tr></table>`, 1, 4, true, true},
+		{"limit only", `<table><tr><td>Session Limit</td><td>8</td></tr></table>`, 0, 8, false, true},
+		{"none", `<table><tr><td>Uptime</td><td>3 days</td></tr></table>`, 0, 0, false, false},
+	}
+	for _, tt := range tests {
+		doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.page))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions := parseSessions(doc)
+		if (sessions.Active != nil) != tt.hasActive || tt.hasActive && *sessions.Active != tt.active {
+			t.Errorf("%s: got active %v, want %v", tt.name, sessions.Active, tt.active)
+		}
+		if (sessions.Max != nil) != tt.hasMax || tt.hasMax && *sessions.Max != tt.max {
+			t.Errorf("%s: got max %v, want %v", tt.name, sessions.Max, tt.max)
+		}
+	}
+}
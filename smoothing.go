@@ -0,0 +1,54 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// smoothedBytes is the exponential moving average of the byte counters of
+// a port, along with the raw counters it was last updated with.
+type smoothedBytes struct {
+	Rx    float64
+	Tx    float64
+	RawRx uint64
+	RawTx uint64
+}
+
+// updateSmoothing folds the fetched byte counters into their moving
+// averages. A port's first sample, and a sample after its counters went
+// backwards, starts the average over from the raw value.
+func (c *PortStatsCollector) updateSmoothing(stats PortStatistics) {
+	alpha := c.config.SmoothingAlpha
+	if alpha <= 0 {
+		return
+	}
+
+	previous := c.smoothed
+	c.smoothed = make(map[string]smoothedBytes, len(stats.Ports))
+	for _, port := range stats.Ports {
+		s := smoothedBytes{
+			Rx:    float64(port.RxGoodBytes),
+			Tx:    float64(port.TxGoodBytes),
+			RawRx: port.RxGoodBytes,
+			RawTx: port.TxGoodBytes,
+		}
+		prev, ok := previous[port.Name]
+		if ok && s.RawRx >= prev.RawRx && s.RawTx >= prev.RawTx {
+			s.Rx = alpha*s.Rx + (1-alpha)*prev.Rx
+			s.Tx = alpha*s.Tx + (1-alpha)*prev.Tx
+		}
+		c.smoothed[port.Name] = s
+	}
+}
+
+func (c *PortStatsCollector) collectSmoothing(ch chan<- prometheus.Metric, name string, labels []string) {
+	s, ok := c.smoothed[name]
+	if !ok {
+		return
+	}
+	ch <- c.constMetric(
+		c.portRxBytesSmoothed, prometheus.GaugeValue, s.Rx, labels...,
+	)
+	ch <- c.constMetric(
+		c.portTxBytesSmoothed, prometheus.GaugeValue, s.Tx, labels...,
+	)
+}
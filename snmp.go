@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gosnmp/gosnmp"
+)
+
+// IF-MIB columns read in SNMP mode. The 64-bit ifXTable counters are
+// preferred and the 32-bit ifTable ones are used when the agent lacks them.
+const (
+	oidIfDescr          = ".1.3.6.1.2.1.2.2.1.2"
+	oidIfType           = ".1.3.6.1.2.1.2.2.1.3"
+	oidIfAdminStatus    = ".1.3.6.1.2.1.2.2.1.7"
+	oidIfOperStatus     = ".1.3.6.1.2.1.2.2.1.8"
+	oidIfInOctets       = ".1.3.6.1.2.1.2.2.1.10"
+	oidIfInUcastPkts    = ".1.3.6.1.2.1.2.2.1.11"
+	oidIfOutOctets      = ".1.3.6.1.2.1.2.2.1.16"
+	oidIfOutUcastPkts   = ".1.3.6.1.2.1.2.2.1.17"
+	oidIfName           = ".1.3.6.1.2.1.31.1.1.1.1"
+	oidIfHCInOctets     = ".1.3.6.1.2.1.31.1.1.1.6"
+	oidIfHCInUcastPkts  = ".1.3.6.1.2.1.31.1.1.1.7"
+	oidIfHCOutOctets    = ".1.3.6.1.2.1.31.1.1.1.10"
+	oidIfHCOutUcastPkts = ".1.3.6.1.2.1.31.1.1.1.11"
+)
+
+// ethernetIfTypes are the ifType values treated as switch ports; VLAN and
+// CPU interfaces are skipped.
+var ethernetIfTypes = map[uint64]bool{
+	6:   true, // ethernetCsmacd
+	62:  true, // fastEther
+	69:  true, // fastEtherFX
+	117: true, // gigabitEthernet
+}
+
+// snmpColumn maps ifIndex to the value of one table column.
+type snmpColumn map[int]gosnmp.SnmpPDU
+
+func fetchSNMPPortStatistics(ctx context.Context, config Config) (PortStatistics, error) {
+	release, err := acquireSwitch(ctx, config)
+	if err != nil {
+		return PortStatistics{}, err
+	}
+	defer release()
+
+	host := config.Address
+	if h, _, err := net.SplitHostPort(config.Address); err == nil {
+		host = h
+	}
+
+	client := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      uint16(config.SNMPPort),
+		Community: config.SNMPCommunity,
+		Version:   gosnmp.Version2c,
+		Timeout:   time.Duration(config.Timeout) * time.Second,
+		Retries:   1,
+		MaxOids:   gosnmp.MaxOids,
+		Context:   ctx,
+	}
+	if config.SNMPVersion == "1" {
+		client.Version = gosnmp.Version1
+	}
+
+	if err := client.Connect(); err != nil {
+		return PortStatistics{}, fmt.Errorf("error connecting to SNMP agent: %w", err)
+	}
+	defer client.Conn.Close()
+
+	columns := map[string]snmpColumn{}
+	for _, oid := range []string{
+		oidIfDescr, oidIfType, oidIfAdminStatus, oidIfOperStatus,
+		oidIfInOctets, oidIfInUcastPkts, oidIfOutOctets, oidIfOutUcastPkts,
+		oidIfName, oidIfHCInOctets, oidIfHCInUcastPkts, oidIfHCOutOctets, oidIfHCOutUcastPkts,
+	} {
+		column, err := walkColumn(client, oid)
+		if err != nil {
+			return PortStatistics{}, fmt.Errorf("error walking %s: %w", oid, err)
+		}
+		columns[oid] = column
+	}
+
+	if len(columns[oidIfDescr]) == 0 {
+		return PortStatistics{}, fmt.Errorf("agent returned no interfaces")
+	}
+
+	return buildSNMPPortStatistics(columns), nil
+}
+
+func walkColumn(client *gosnmp.GoSNMP, oid string) (snmpColumn, error) {
+	walk := client.BulkWalkAll
+	if client.Version == gosnmp.Version1 {
+		walk = client.WalkAll
+	}
+
+	pdus, err := walk(oid)
+	if err != nil {
+		return nil, err
+	}
+
+	column := snmpColumn{}
+	for _, pdu := range pdus {
+		index, err := strconv.Atoi(pdu.Name[strings.LastIndex(pdu.Name, ".")+1:])
+		if err != nil {
+			continue
+		}
+		column[index] = pdu
+	}
+	return column, nil
+}
+
+// buildSNMPPortStatistics maps IF-MIB columns onto Port using the same state
+// and link status texts as the web interface.
+func buildSNMPPortStatistics(columns map[string]snmpColumn) PortStatistics {
+	var indexes []int
+	for index := range columns[oidIfDescr] {
+		if pdu, ok := columns[oidIfType][index]; ok && !ethernetIfTypes[gosnmp.ToBigInt(pdu.Value).Uint64()] {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	var stats PortStatistics
+	for _, index := range indexes {
+		port := Port{
+			Name:        snmpString(columns[oidIfName], index),
+			State:       "Disable",
+			LinkStatus:  "Link Down",
+			TxGoodPkt:   snmpCounter(columns, oidIfHCOutUcastPkts, oidIfOutUcastPkts, index),
+			RxGoodPkt:   snmpCounter(columns, oidIfHCInUcastPkts, oidIfInUcastPkts, index),
+			TxGoodBytes: snmpCounter(columns, oidIfHCOutOctets, oidIfOutOctets, index),
+			RxGoodBytes: snmpCounter(columns, oidIfHCInOctets, oidIfInOctets, index),
+		}
+		if port.Name == "" {
+			port.Name = snmpString(columns[oidIfDescr], index)
+		}
+		// up(1), down(2), testing(3)
+		if pdu, ok := columns[oidIfAdminStatus][index]; ok && gosnmp.ToBigInt(pdu.Value).Int64() == 1 {
+			port.State = "Enable"
+		}
+		if pdu, ok := columns[oidIfOperStatus][index]; ok && gosnmp.ToBigInt(pdu.Value).Int64() == 1 {
+			port.LinkStatus = "Link Up"
+		}
+		stats.Ports = append(stats.Ports, port)
+	}
+
+	return stats
+}
+
+func snmpString(column snmpColumn, index int) string {
+	pdu, ok := column[index]
+	if !ok {
+		return ""
+	}
+	if b, ok := pdu.Value.([]byte); ok {
+		return strings.TrimSpace(string(b))
+	}
+	return ""
+}
+
+func snmpCounter(columns map[string]snmpColumn, hcOID, oid string, index int) uint64 {
+	if pdu, ok := columns[hcOID][index]; ok {
+		return gosnmp.ToBigInt(pdu.Value).Uint64()
+	}
+	if pdu, ok := columns[oid][index]; ok {
+		return gosnmp.ToBigInt(pdu.Value).Uint64()
+	}
+	return 0
+}
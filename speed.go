@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// PortSpeed holds the administratively configured and the negotiated speed
+// of a port in Mbps. A configured speed of 0 means auto-negotiation.
+type PortSpeed struct {
+	Configured    float64
+	HasConfigured bool
+	Link          float64
+	HasLink       bool
+}
+
+var speedPattern = regexp.MustCompile(`(?i)(\d+(?:\.\d+)?)\s*([MG])`)
+
+func (c *PortStatsCollector) refreshPortSpeeds(ctx context.Context) {
+	speeds, err := fetchPortSpeeds(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching port settings: %v", err)
+		return
+	}
+	c.portSpeeds = truncateKeys(c, speeds)
+}
+
+func (c *PortStatsCollector) collectPortSpeeds(ch chan<- prometheus.Metric) {
+	for name, speed := range c.portSpeeds {
+		labels := []string{name, c.portRole(name)}
+		if speed.HasConfigured {
+			ch <- c.constMetric(
+				c.portConfiguredSpeed, prometheus.GaugeValue,
+				speed.Configured, labels...,
+			)
+		}
+		if speed.HasLink {
+			ch <- c.constMetric(
+				c.portLinkSpeed, prometheus.GaugeValue,
+				speed.Link, labels...,
+			)
+		}
+	}
+}
+
+func fetchPortSpeeds(ctx context.Context, config Config) (map[string]PortSpeed, error) {
+	doc, err := fetchDocument(ctx, config, config.PortSettingsPath)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePortSpeeds(doc), nil
+}
+
+// parsePortSpeeds reads the port settings table. The speed columns are found
+// by their "Config" and "Actual" headers; without such headers the stock
+// layout (port, state, configured speed, actual speed) is assumed.
+func parsePortSpeeds(doc *goquery.Document) map[string]PortSpeed {
+	speeds := map[string]PortSpeed{}
+	configuredCol, linkCol := 2, 3
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		if headers := s.Find("th"); headers.Length() > 0 {
+			// The speed columns come before the flow control ones, so the
+			// first match wins
+			foundConfigured, foundLink := false, false
+			headers.Each(func(j int, th *goquery.Selection) {
+				text := strings.ToLower(th.Text())
+				switch {
+				case !foundConfigured && strings.Contains(text, "config"):
+					configuredCol, foundConfigured = j, true
+				case !foundLink && strings.Contains(text, "actual"):
+					linkCol, foundLink = j, true
+				}
+			})
+			return
+		}
+
+		cells := s.Find("td")
+		name := strings.TrimSpace(cells.First().Text())
+		if name == "" || cells.Length() <= max(configuredCol, linkCol) {
+			return
+		}
+
+		var speed PortSpeed
+		speed.Configured, speed.HasConfigured = parseSpeedMbps(cells.Eq(configuredCol).Text())
+		speed.Link, speed.HasLink = parseSpeedMbps(cells.Eq(linkCol).Text())
+		speeds[name] = speed
+	})
+
+	return speeds
+}
+
+// parseSpeedMbps converts texts such as "100M Full", "1G" or "Auto" to Mbps.
+// "Auto" and a down link both yield 0.
+func parseSpeedMbps(text string) (float64, bool) {
+	lower := strings.ToLower(strings.TrimSpace(text))
+	if strings.HasPrefix(lower, "auto") || strings.Contains(lower, "down") {
+		return 0, true
+	}
+
+	match := speedPattern.FindStringSubmatch(text)
+	if match == nil {
+		return 0, false
+	}
+	value, err := strconv.ParseFloat(match[1], 64)
+	if err != nil {
+		return 0, false
+	}
+	if strings.EqualFold(match[2], "G") {
+		value *= 1000
+	}
+	return value, true
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sshTunnel forwards connections accepted on a local port to the switch
+// through an SSH jump host. The SSH connection is opened on first use and
+// re-established after it breaks.
+type sshTunnel struct {
+	host         string // jump host
+	target       string // switch address as seen from the jump host
+	clientConfig *ssh.ClientConfig
+	listener     net.Listener
+
+	mutex  sync.Mutex
+	client *ssh.Client
+}
+
+var (
+	sshTunnelsMutex sync.Mutex
+	sshTunnels      = map[string]*sshTunnel{}
+)
+
+// openSSHTunnel returns the tunnel for config, starting it on first use.
+// Configs with the same SSH settings and switch share a tunnel, so it
+// survives reloads that leave them unchanged.
+func openSSHTunnel(config Config) (*sshTunnel, error) {
+	host := config.SSHHost
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	target := sshTarget(config)
+	key := strings.Join([]string{host, config.SSHUser, config.SSHKeyFile, config.SSHKnownHostsFile,
+		strconv.FormatBool(config.SSHInsecureIgnoreHostKey), target}, "\x00")
+
+	sshTunnelsMutex.Lock()
+	defer sshTunnelsMutex.Unlock()
+	if tunnel, ok := sshTunnels[key]; ok {
+		return tunnel, nil
+	}
+
+	clientConfig, err := sshClientConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("error opening SSH tunnel port: %w", err)
+	}
+	tunnel := &sshTunnel{
+		host:         host,
+		target:       target,
+		clientConfig: clientConfig,
+		listener:     listener,
+	}
+	sshTunnels[key] = tunnel
+	go tunnel.serve()
+
+	log.Printf("Forwarding %s to %s through SSH host %s", tunnel.Addr(), target, host)
+	return tunnel, nil
+}
+
+// sshTarget is the address the jump host connects to: the switch address
+// with the default port of the collect mode if it has none.
+func sshTarget(config Config) string {
+	port := "80"
+	if config.CollectMode == "telnet" {
+		port = strconv.Itoa(config.TelnetPort)
+	}
+	if _, _, err := net.SplitHostPort(config.Address); err == nil {
+		return config.Address
+	}
+	return net.JoinHostPort(strings.Trim(config.Address, "[]"), port)
+}
+
+func sshClientConfig(config Config) (*ssh.ClientConfig, error) {
+	key, err := os.ReadFile(config.SSHKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ssh_key_file: %w", err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing ssh_key_file: %w", err)
+	}
+
+	hostKeyCallback := ssh.InsecureIgnoreHostKey()
+	if !config.SSHInsecureIgnoreHostKey {
+		hostKeyCallback, err = knownhosts.New(config.SSHKnownHostsFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading ssh_known_hosts_file: %w", err)
+		}
+	}
+
+	return &ssh.ClientConfig{
+		User:            config.SSHUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         time.Duration(config.ConnectTimeout) * time.Second,
+	}, nil
+}
+
+// Addr is the local address that reaches the switch.
+func (t *sshTunnel) Addr() string {
+	return t.listener.Addr().String()
+}
+
+func (t *sshTunnel) serve() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			log.Printf("SSH tunnel to %s stopped: %v", t.target, err)
+			return
+		}
+		go t.forward(conn)
+	}
+}
+
+func (t *sshTunnel) forward(local net.Conn) {
+	defer local.Close()
+
+	remote, err := t.dial()
+	if err != nil {
+		log.Printf("Error connecting to %s through SSH host %s: %v", t.target, t.host, err)
+		return
+	}
+	defer remote.Close()
+
+	// Either side closing ends the forward, the deferred closes stop the
+	// other copy
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func (t *sshTunnel) dial() (net.Conn, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.client == nil {
+		client, err := ssh.Dial("tcp", t.host, t.clientConfig)
+		if err != nil {
+			return nil, err
+		}
+		t.client = client
+	}
+	conn, err := t.client.Dial("tcp", t.target)
+	if err != nil {
+		// The SSH connection may be dead, reconnect on the next attempt
+		t.client.Close()
+		t.client = nil
+		return nil, err
+	}
+	return conn, nil
+}
+
+func validateSSHConfig(config Config) error {
+	if config.SSHUser == "" || config.SSHKeyFile == "" {
+		return errors.New("ssh_host requires ssh_user and ssh_key_file")
+	}
+	if config.SSHKnownHostsFile == "" && !config.SSHInsecureIgnoreHostKey {
+		return errors.New("ssh_host requires ssh_known_hosts_file or ssh_insecure_ignore_host_key")
+	}
+	if config.CollectMode == "snmp" {
+		return errors.New("ssh_host cannot tunnel collect_mode snmp")
+	}
+	if config.SourceAddress != "" {
+		return errors.New("ssh_host and source_address cannot be combined")
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// stateSaveInterval is how often the collector state is written to
+// state_file, besides on shutdown.
+const stateSaveInterval = time.Minute
+
+// collectorState is the per-port history persisted in state_file, so
+// utilization, smoothing, presence and the counters_reset_on_read totals
+// pick up where they left off after a restart instead of starting over.
+type collectorState struct {
+	Samples      map[string]portSample    `json:"samples"`
+	Smoothed     map[string]smoothedBytes `json:"smoothed"`
+	PortLastSeen map[string]time.Time     `json:"port_last_seen"`
+	Totals       map[string]portCounters  `json:"counter_totals"`
+	Raw          map[string]portCounters  `json:"counter_raw"`
+}
+
+// LoadState restores the state saved in state_file. A missing or corrupt
+// file leaves the collector starting fresh.
+func (c *PortStatsCollector) LoadState() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	path := c.config.StateFile
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error reading state file, starting fresh: %v", err)
+		return
+	}
+	var state collectorState
+	if err := json.Unmarshal(data, &state); err != nil {
+		log.Printf("Ignoring corrupt state file %s: %v", path, err)
+		return
+	}
+
+	c.samples = state.Samples
+	c.smoothed = state.Smoothed
+	c.portLastSeen = state.PortLastSeen
+	c.counterTotals = state.Totals
+	c.counterRaw = state.Raw
+	log.Printf("Restored state of %d ports from %s", len(state.Samples), path)
+}
+
+// SaveState writes the state to state_file, replacing it atomically so a
+// crash mid-write cannot leave a truncated file.
+func (c *PortStatsCollector) SaveState() error {
+	c.mutex.Lock()
+	path := c.config.StateFile
+	data, err := json.Marshal(collectorState{
+		Samples:      c.samples,
+		Smoothed:     c.smoothed,
+		PortLastSeen: c.portLastSeen,
+		Totals:       c.counterTotals,
+		Raw:          c.counterRaw,
+	})
+	c.mutex.Unlock()
+	if err != nil || path == "" {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// PersistState saves the state every stateSaveInterval until ctx is done.
+func (c *PortStatsCollector) PersistState(ctx context.Context) {
+	ticker := time.NewTicker(stateSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := c.SaveState(); err != nil {
+				log.Printf("Error saving state: %v", err)
+			}
+		}
+	}
+}
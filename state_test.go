@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// stateJSON is the state of c as SaveState would write it.
+func stateJSON(t *testing.T, c *PortStatsCollector) string {
+	t.Helper()
+	data, err := json.Marshal(collectorState{
+		Samples:      c.samples,
+		Smoothed:     c.smoothed,
+		PortLastSeen: c.portLastSeen,
+		Totals:       c.counterTotals,
+		Raw:          c.counterRaw,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	config := testConfig(t, "192.168.1.1", func(c *Config) {
+		c.StateFile = filepath.Join(t.TempDir(), "state.json")
+		c.CountersResetOnRead = true
+		c.PortLinkSpeeds = map[string]float64{"Port 1": 1000}
+	})
+	router, saved, _ := newFakeRouter(config)
+	get(t, router, "/metrics")
+	if err := saved.SaveState(); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved.samples) == 0 || len(saved.portLastSeen) == 0 || len(saved.counterTotals) == 0 {
+		t.Fatalf("nothing to save after a scrape: %s", stateJSON(t, saved))
+	}
+
+	router, restored, _ := newFakeRouter(config)
+	restored.LoadState()
+	if got, want := stateJSON(t, restored), stateJSON(t, saved); got != want {
+		t.Errorf("restored state\n%s\nwant\n%s", got, want)
+	}
+	// The fake switch clears its counters on read, the totals continue
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body, `port_tx_good_pkt{port="Port 1",role="unknown"} 20`)
+
+	entries, err := os.ReadDir(filepath.Dir(config.StateFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("got %d files next to the state file, want no leftovers", len(entries))
+	}
+}
+
+func TestLoadStateStartsFresh(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.json")
+	writeFile(t, corrupt, `{"samples": {"Port 1": `)
+
+	for _, path := range []string{filepath.Join(dir, "missing.json"), corrupt} {
+		c := NewPortStatsCollector(testConfig(t, "192.168.1.1", func(c *Config) { c.StateFile = path }), prometheus.NewRegistry())
+		c.LoadState()
+		if len(c.samples) != 0 || len(c.portLastSeen) != 0 || len(c.counterTotals) != 0 {
+			t.Errorf("%s: got state %s, want none", filepath.Base(path), stateJSON(t, c))
+		}
+	}
+}
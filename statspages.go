@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// StatsPage is one page of port data for firmware that spreads the
+// statistics over several CGI endpoints.
+type StatsPage struct {
+	Path string `yaml:"path"`
+	// TableSelector overrides table_selector for this page.
+	TableSelector string `yaml:"table_selector"`
+	// Columns maps port fields to the zero-based index of the table cell
+	// holding them. The port column is required to merge the pages.
+	Columns map[string]int `yaml:"columns"`
+	// Cells is the number of cells a row is expected to have. Unset, only
+	// rows too short for Columns count as mismatched.
+	Cells int `yaml:"cells"`
+}
+
+// statsFields are the port fields a stats page column can be mapped to.
+var statsFields = []string{
+	"port", "state", "link_status",
+	"tx_good_pkt", "rx_good_pkt", "rx_good_bytes", "tx_good_bytes",
+}
+
+// defaultStatsPath is the stats page of the stock firmware.
+const defaultStatsPath = "/port.cgi?page=stats"
+
+// defaultTableSelector matches the rows of every table on the page, which
+// suits the stock firmware with its single table. On pages with more
+// tables, statsTableRows narrows it down to the stats table.
+const defaultTableSelector = "table tr"
+
+// statsTableRows returns the rows of the first table on the page that looks
+// like the stats table: its first row has a cell mentioning the port and
+// enough cells for the layout. Rows of nested tables are left out. Without
+// such a table, the rows of every table are returned.
+func statsTableRows(doc *goquery.Document, required, cells int) *goquery.Selection {
+	var rows *goquery.Selection
+	doc.Find("table").EachWithBreak(func(i int, table *goquery.Selection) bool {
+		own := table.Find("tr").FilterFunction(func(_ int, tr *goquery.Selection) bool {
+			return tr.Closest("table").IsSelection(table)
+		})
+		header := own.First().ChildrenFiltered("th, td")
+		if n := header.Length(); n < required || cells > 0 && n != cells {
+			return true
+		}
+		mentionsPort := false
+		header.Each(func(_ int, cell *goquery.Selection) {
+			mentionsPort = mentionsPort || strings.Contains(strings.ToLower(cell.Text()), "port")
+		})
+		if !mentionsPort {
+			return true
+		}
+		debugf("Reading the stats from table %d of the page", i)
+		rows = own
+		return false
+	})
+	if rows == nil {
+		return doc.Find(defaultTableSelector)
+	}
+	return rows
+}
+
+// defaultStatsColumns is the layout of the stock port.cgi?page=stats table.
+var defaultStatsColumns = map[string]int{
+	"port":          0,
+	"state":         1,
+	"link_status":   2,
+	"tx_good_pkt":   3,
+	"rx_good_pkt":   4,
+	"rx_good_bytes": 5,
+	"tx_good_bytes": 6,
+}
+
+// groupingSeparators are the thousands separators stripped from counters by
+// number_format.
+var groupingSeparators = map[string]string{
+	"plain":         "",
+	"comma_grouped": ",",
+	"dot_grouped":   ".",
+}
+
+// setPortField sets field of port from its text on the stats page, reading
+// counters in numberFormat.
+func setPortField(port *Port, field, text, numberFormat string) {
+	separator := groupingSeparators[numberFormat]
+	switch field {
+	case "port":
+		port.Name = strings.TrimSpace(text)
+	case "state":
+		port.State = strings.TrimSpace(text)
+	case "link_status":
+		port.LinkStatus = strings.TrimSpace(text)
+	case "tx_good_pkt":
+		port.TxGoodPkt = parseStatValue(text, separator)
+	case "rx_good_pkt":
+		port.RxGoodPkt = parseStatValue(text, separator)
+	case "rx_good_bytes":
+		port.RxGoodBytes = parseStatValue(text, separator)
+	case "tx_good_bytes":
+		port.TxGoodBytes = parseStatValue(text, separator)
+	}
+}
+
+// copyPortField sets field of dst to its value in src.
+func copyPortField(dst *Port, src Port, field string) {
+	switch field {
+	case "state":
+		dst.State = src.State
+	case "link_status":
+		dst.LinkStatus = src.LinkStatus
+	case "tx_good_pkt":
+		dst.TxGoodPkt = src.TxGoodPkt
+	case "rx_good_pkt":
+		dst.RxGoodPkt = src.RxGoodPkt
+	case "rx_good_bytes":
+		dst.RxGoodBytes = src.RxGoodBytes
+	case "tx_good_bytes":
+		dst.TxGoodBytes = src.TxGoodBytes
+	}
+}
+
+// fetchStatsPages fetches every configured stats page and merges the ports
+// by name, each page filling in the fields it has columns for. Ports are
+// ordered by first appearance; a port missing from some pages keeps zero
+// values for the fields only those pages provide.
+func fetchStatsPages(ctx context.Context, config Config) (PortStatistics, error) {
+	var merged PortStatistics
+	index := make(map[string]int)
+
+	for _, page := range config.StatsPages {
+		stats, jsonFields, err := fetchStatsPage(ctx, config, page)
+		if err != nil {
+			return PortStatistics{}, fmt.Errorf("stats page %s: %w", page.Path, err)
+		}
+
+		if !stats.SwitchTime.IsZero() {
+			merged.SwitchTime = stats.SwitchTime
+		}
+
+		var columns []string
+		for field := range page.Columns {
+			columns = append(columns, field)
+		}
+
+		for _, port := range stats.Ports {
+			i, ok := index[port.Name]
+			if !ok {
+				i = len(merged.Ports)
+				index[port.Name] = i
+				merged.Ports = append(merged.Ports, Port{Name: port.Name})
+			}
+			fields := columns
+			if jsonFields != nil {
+				fields = jsonFields[port.Name]
+			}
+			for _, field := range fields {
+				copyPortField(&merged.Ports[i], port, field)
+			}
+		}
+	}
+
+	return merged, nil
+}
+
+// jsonPortFields returns the fields each entry of a JSON stats page
+// carries, by trimmed port name, so that merging the page leaves the fields
+// it lacks to the other pages. A field set to null counts as missing.
+func jsonPortFields(body []byte) map[string][]string {
+	var entries []map[string]json.RawMessage
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		json.Unmarshal(body, &entries)
+	} else {
+		var page struct {
+			Ports []map[string]json.RawMessage `json:"port_statistics"`
+		}
+		json.Unmarshal(body, &page)
+		entries = page.Ports
+	}
+
+	fields := make(map[string][]string, len(entries))
+	for _, entry := range entries {
+		var name string
+		if json.Unmarshal(entry["port"], &name) != nil {
+			continue
+		}
+		name = strings.TrimSpace(name)
+		for _, field := range statsFields {
+			if value, ok := entry[field]; ok && string(value) != "null" {
+				fields[name] = append(fields[name], field)
+			}
+		}
+	}
+	return fields
+}
+
+func validateStatsPages(pages []StatsPage) error {
+	for _, page := range pages {
+		if page.Path == "" {
+			return errors.New("stats page without a path")
+		}
+		if _, ok := page.Columns["port"]; !ok {
+			return fmt.Errorf("stats page %s has no port column", page.Path)
+		}
+		if page.Cells < 0 {
+			return fmt.Errorf("stats page %s: negative cells", page.Path)
+		}
+		if err := validateSelector(page.TableSelector); err != nil {
+			return fmt.Errorf("stats page %s: %w", page.Path, err)
+		}
+		for field, column := range page.Columns {
+			if !slices.Contains(statsFields, field) {
+				return fmt.Errorf("stats page %s: unknown column %q", page.Path, field)
+			}
+			if column < 0 {
+				return fmt.Errorf("stats page %s: negative index for column %q", page.Path, field)
+			}
+		}
+	}
+	return nil
+}
+
+func validateSelector(selector string) error {
+	if selector == "" {
+		return nil
+	}
+	if _, err := cascadia.Compile(selector); err != nil {
+		return fmt.Errorf("invalid table_selector %q: %w", selector, err)
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFetchStatsPagesMergesJSON(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/port.cgi?page=status": `<table>
+<tr><th>Port</th><th>State</th><th>Link Status</th></tr>
+<tr><td>Port 1</td><td>Enable</td><td>Link Up</td></tr>
+<tr><td>Port 2</td><td>Disable</td><td>Link Down</td></tr>
+</table>`,
+		"/port.cgi?page=counters": `{"port_statistics": [
+{"port": " Port 1 ", "tx_good_pkt": 10, "rx_good_pkt": 20},
+{"port": "Port 2", "tx_good_pkt": 30, "state": null},
+{"port": "Port 3", "tx_good_pkt": 40, "state": "Enable"}
+]}`,
+	})
+	config := testConfig(t, sw.Address(), func(c *Config) {
+		c.StatsPages = []StatsPage{
+			{Path: "/port.cgi?page=status", Columns: map[string]int{"port": 0, "state": 1, "link_status": 2}},
+			{Path: "/port.cgi?page=counters", Columns: map[string]int{"port": 0}},
+		}
+	})
+
+	stats, err := fetchPortStatistics(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Port{
+		{Name: "Port 1", State: "Enable", LinkStatus: "Link Up", TxGoodPkt: 10, RxGoodPkt: 20},
+		{Name: "Port 2", State: "Disable", LinkStatus: "Link Down", TxGoodPkt: 30},
+		{Name: "Port 3", State: "Enable", TxGoodPkt: 40},
+	}
+	if len(stats.Ports) != len(want) {
+		t.Fatalf("got %d ports, want %d: %+v", len(stats.Ports), len(want), stats.Ports)
+	}
+	for i, port := range stats.Ports {
+		if port != want[i] {
+			t.Errorf("port %d: got %+v, want %+v", i, port, want[i])
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultSwitchTimeLayout is the date format most firmware uses for its
+// clock display.
+const defaultSwitchTimeLayout = "2006-01-02 15:04:05"
+
+// parseSwitchTime reads the clock the firmware shows on the stats page from
+// the element matched by switch_time_selector. A missing or unparseable
+// time yields the zero time; the metric is then left out.
+func parseSwitchTime(doc *goquery.Document, config Config) time.Time {
+	text := strings.TrimSpace(doc.Find(config.SwitchTimeSelector).First().Text())
+	if text == "" {
+		debugf("No switch time found at %q", config.SwitchTimeSelector)
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(config.SwitchTimeLayout, text, time.Local)
+	if err != nil {
+		debugf("Ignoring unparseable switch time %q: %v", text, err)
+		return time.Time{}
+	}
+	return t
+}
+
+// collectSwitchTime exports the switch clock, advanced by the age of cached
+// statistics so it stays comparable with the scrape time.
+func (c *PortStatsCollector) collectSwitchTime(ch chan<- prometheus.Metric, stats PortStatistics, age time.Duration) {
+	if stats.SwitchTime.IsZero() {
+		return
+	}
+	ch <- c.constMetric(
+		c.switchTime, prometheus.GaugeValue,
+		float64(stats.SwitchTime.Add(age).UnixNano())/1e9,
+	)
+}
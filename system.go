@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// SystemUsage holds CPU and memory utilization as ratios between 0 and 1.
+// Readings that could not be found are left nil.
+type SystemUsage struct {
+	CPU    *float64
+	Memory *float64
+}
+
+func (c *PortStatsCollector) refreshSystemUsage(ctx context.Context) {
+	usage, err := fetchSystemUsage(ctx, c.config)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching system usage: %v", err)
+		return
+	}
+	c.systemUsage = usage
+}
+
+func (c *PortStatsCollector) collectSystemUsage(ch chan<- prometheus.Metric) {
+	usage := c.systemUsage
+
+	if usage.CPU != nil {
+		ch <- c.constMetric(
+			c.switchCPUUsage, prometheus.GaugeValue, *usage.CPU,
+		)
+	}
+	if usage.Memory != nil {
+		ch <- c.constMetric(
+			c.switchMemoryUsage, prometheus.GaugeValue, *usage.Memory,
+		)
+	}
+}
+
+func fetchSystemUsage(ctx context.Context, config Config) (SystemUsage, error) {
+	doc, err := fetchDocument(ctx, config, config.SystemPath)
+	if err != nil {
+		return SystemUsage{}, err
+	}
+
+	return parseSystemUsage(doc, config.CPULabel, config.MemoryLabel), nil
+}
+
+// parseSystemUsage finds the rows whose label contains cpuLabel or
+// memoryLabel (case-insensitive) and normalizes their values to ratios.
+func parseSystemUsage(doc *goquery.Document, cpuLabel, memoryLabel string) SystemUsage {
+	var usage SystemUsage
+
+	eachLabeledRow(doc, func(label, text string) {
+		label = strings.ToLower(label)
+		switch {
+		case usage.CPU == nil && strings.Contains(label, strings.ToLower(cpuLabel)):
+			if ratio, ok := parseUsageRatio(text); ok {
+				usage.CPU = &ratio
+			}
+		case usage.Memory == nil && strings.Contains(label, strings.ToLower(memoryLabel)):
+			if ratio, ok := parseUsageRatio(text); ok {
+				usage.Memory = &ratio
+			}
+		}
+	})
+
+	return usage
+}
+
+// parseUsageRatio understands "45%", "45", "0.45" and "used/total" forms
+// such as "12MB / 64MB".
+func parseUsageRatio(text string) (float64, bool) {
+	if used, total, found := strings.Cut(text, "/"); found {
+		u, ok1 := parseNumber(used)
+		t, ok2 := parseNumber(total)
+		if !ok1 || !ok2 || t <= 0 {
+			return 0, false
+		}
+		return checkRatio(u / t)
+	}
+
+	value, ok := parseNumber(text)
+	if !ok {
+		return 0, false
+	}
+	if strings.Contains(text, "%") || value > 1 {
+		value /= 100
+	}
+	return checkRatio(value)
+}
+
+func checkRatio(value float64) (float64, bool) {
+	if value < 0 || value > 1 {
+		return 0, false
+	}
+	return value, true
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// targetStatus is the state of one switch as listed on /targets. It holds
+// no credentials.
+type targetStatus struct {
+	Address string            `json:"address"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	// LastResult is the result of the last fetch from the switch:
+	// "success", "error", "busy", or "unknown" before the first one.
+	LastResult          string     `json:"last_result"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastAttempt         *time.Time `json:"last_attempt,omitempty"`
+	LastSuccess         *time.Time `json:"last_success,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+// storeStatus records the outcome of a fetch for /targets. It must be
+// called with the collector mutex held.
+func (c *PortStatsCollector) storeStatus(result string, err error) {
+	status := &targetStatus{
+		Address:             c.config.Address,
+		Labels:              c.config.Labels,
+		LastResult:          result,
+		ConsecutiveFailures: c.consecutiveFailures,
+	}
+	if err != nil {
+		status.LastError = err.Error()
+	}
+	if result != "unknown" {
+		now := time.Now()
+		status.LastAttempt = &now
+	}
+	if !c.lastSuccess.IsZero() {
+		lastSuccess := c.lastSuccess
+		status.LastSuccess = &lastSuccess
+	}
+	c.status.Store(status)
+}
+
+// targetsHandler lists the configured switch and the discovered ones with
+// the outcome of their last fetch, without waiting for running scrapes.
+func targetsHandler(collector *PortStatsCollector, discovered *discovery) http.Handler {
+	// Without an address only discovered switches are scraped
+	configured := collector.Config().Address != ""
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var collectors []*PortStatsCollector
+		if configured {
+			collectors = append(collectors, collector)
+		}
+		if discovered != nil {
+			collectors = append(collectors, discovered.Collectors()...)
+		}
+		targets := make([]*targetStatus, 0, len(collectors))
+		for _, c := range collectors {
+			targets = append(targets, c.status.Load())
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(targets); err != nil {
+			debugf("Error writing targets: %v", err)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Telnet protocol bytes needed to refuse option negotiation.
+const (
+	telnetIAC  = 255
+	telnetDONT = 254
+	telnetDO   = 253
+	telnetWONT = 252
+	telnetWILL = 251
+	telnetSB   = 250
+	telnetSE   = 240
+)
+
+// telnetSession is a line-oriented telnet connection that declines every
+// option the switch offers.
+type telnetSession struct {
+	conn net.Conn
+	buf  []byte
+}
+
+func fetchTelnetPortStatistics(ctx context.Context, config Config) (PortStatistics, error) {
+	release, err := acquireSwitch(ctx, config)
+	if err != nil {
+		return PortStatistics{}, err
+	}
+	defer release()
+
+	address := config.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, strconv.Itoa(config.TelnetPort))
+	}
+	if config.SSHHost != "" {
+		tunnel, err := openSSHTunnel(config)
+		if err != nil {
+			return PortStatistics{}, err
+		}
+		address = tunnel.Addr()
+	}
+
+	dialer := &net.Dialer{Timeout: time.Duration(config.ConnectTimeout) * time.Second}
+	if config.SourceAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(config.SourceAddress)}
+	}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return PortStatistics{}, fmt.Errorf("error connecting to telnet: %w", err)
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(time.Duration(config.Timeout) * time.Second)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return PortStatistics{}, err
+	}
+
+	s := &telnetSession{conn: conn}
+	prompt := regexp.MustCompile(config.TelnetPrompt)
+	if config.Username != "" {
+		if _, err := s.readUntil(regexp.MustCompile(config.TelnetUsernamePrompt), nil); err != nil {
+			return PortStatistics{}, fmt.Errorf("waiting for username prompt: %w", err)
+		}
+		if err := s.writeLine(config.Username); err != nil {
+			return PortStatistics{}, err
+		}
+	}
+	if _, err := s.readUntil(regexp.MustCompile(config.TelnetPasswordPrompt), nil); err != nil {
+		return PortStatistics{}, fmt.Errorf("waiting for password prompt: %w", err)
+	}
+	if err := s.writeLine(config.Password); err != nil {
+		return PortStatistics{}, err
+	}
+	if _, err := s.readUntil(prompt, nil); err != nil {
+		return PortStatistics{}, fmt.Errorf("%w: no prompt after login: %v", errLoginFailed, err)
+	}
+
+	if err := s.writeLine(config.TelnetCommand); err != nil {
+		return PortStatistics{}, err
+	}
+	output, err := s.readUntil(prompt, regexp.MustCompile(config.TelnetMorePrompt))
+	if err != nil {
+		return PortStatistics{}, fmt.Errorf("reading command output: %w", err)
+	}
+	// Best effort, the connection is closed anyway
+	s.writeLine("exit")
+
+	return parsePortLines(output, regexp.MustCompile(config.TelnetPortPattern), config.NumberFormat), nil
+}
+
+// readUntil reads until the data received since the last call matches
+// pattern and returns that data. Whenever more matches the tail, a space is
+// sent to page through long output.
+func (s *telnetSession) readUntil(pattern, more *regexp.Regexp) ([]byte, error) {
+	chunk := make([]byte, 4096)
+	for {
+		if loc := pattern.FindIndex(s.buf); loc != nil {
+			out := s.buf[:loc[1]]
+			s.buf = s.buf[loc[1]:]
+			return out, nil
+		}
+		if more != nil {
+			if loc := more.FindIndex(s.buf); loc != nil {
+				s.buf = append(s.buf[:loc[0]], s.buf[loc[1]:]...)
+				if _, err := s.conn.Write([]byte(" ")); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		n, err := s.conn.Read(chunk)
+		if n > 0 {
+			data, rerr := s.negotiate(chunk[:n])
+			if rerr != nil {
+				return nil, rerr
+			}
+			s.buf = append(s.buf, data...)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// negotiate strips telnet commands from data, refusing every option. A
+// command split across reads is treated as data, which the option-free
+// servers on switches do not produce in practice.
+func (s *telnetSession) negotiate(data []byte) ([]byte, error) {
+	var out, reply bytes.Buffer
+	for i := 0; i < len(data); i++ {
+		if data[i] != telnetIAC || i+1 >= len(data) {
+			out.WriteByte(data[i])
+			continue
+		}
+		switch cmd := data[i+1]; cmd {
+		case telnetDO, telnetDONT, telnetWILL, telnetWONT:
+			if i+2 < len(data) {
+				refusal := byte(telnetWONT)
+				if cmd == telnetWILL || cmd == telnetWONT {
+					refusal = telnetDONT
+				}
+				if cmd == telnetDO || cmd == telnetWILL {
+					reply.Write([]byte{telnetIAC, refusal, data[i+2]})
+				}
+			}
+			i += 2
+		case telnetSB:
+			end := bytes.Index(data[i:], []byte{telnetIAC, telnetSE})
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 1
+			}
+		case telnetIAC:
+			out.WriteByte(telnetIAC)
+			i++
+		default:
+			i++
+		}
+	}
+	if reply.Len() > 0 {
+		if _, err := s.conn.Write(reply.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func (s *telnetSession) writeLine(line string) error {
+	_, err := s.conn.Write([]byte(line + "\r\n"))
+	return err
+}
+
+// parsePortLines builds one port from every line matching pattern, for the
+// telnet output and text_table pages. The named groups port, state, link_status, tx_good_pkt,
+// rx_good_pkt, rx_good_bytes and tx_good_bytes fill the fields of the same
+// name; groups left out keep their zero value.
+func parsePortLines(output []byte, pattern *regexp.Regexp, numberFormat string) PortStatistics {
+	var stats PortStatistics
+
+	for _, line := range bytes.Split(output, []byte("\n")) {
+		match := pattern.FindSubmatch(bytes.TrimRight(line, "\r"))
+		if match == nil {
+			continue
+		}
+		var port Port
+		for i, name := range pattern.SubexpNames() {
+			if name != "" {
+				setPortField(&port, name, string(match[i]), numberFormat)
+			}
+		}
+		if port.Name == "" {
+			continue
+		}
+		stats.Ports = append(stats.Ports, port)
+	}
+
+	return stats
+}
+
+func validateTelnetConfig(config Config) error {
+	for name, expr := range map[string]string{
+		"telnet_username_prompt": config.TelnetUsernamePrompt,
+		"telnet_password_prompt": config.TelnetPasswordPrompt,
+		"telnet_prompt":          config.TelnetPrompt,
+		"telnet_more_prompt":     config.TelnetMorePrompt,
+		"telnet_port_pattern":    config.TelnetPortPattern,
+	} {
+		if _, err := regexp.Compile(expr); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+	pattern := regexp.MustCompile(config.TelnetPortPattern)
+	if pattern.SubexpIndex("port") < 0 {
+		return errors.New("telnet_port_pattern needs a (?P<port>...) group")
+	}
+	return nil
+}
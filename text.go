@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// defaultPortLinePattern reads a port per line of text as name, received
+// bytes and packets, then transmitted bytes and packets.
+const defaultPortLinePattern = `^\s*(?P<port>\S+)\s+(?P<rx_good_bytes>\d+)\s+(?P<rx_good_pkt>\d+)\s+(?P<tx_good_bytes>\d+)\s+(?P<tx_good_pkt>\d+)\s*$`
+
+// parseTextTable reads the port statistics of stats_format text_table
+// from the text of the elements matching TextSelector, typically a <pre>
+// block of whitespace-aligned columns, one port per line matching
+// TextPortPattern.
+func parseTextTable(doc *goquery.Document, config Config) PortStatistics {
+	text := doc.Find(config.TextSelector).Text()
+	return parsePortLines([]byte(text), regexp.MustCompile(config.TextPortPattern), config.NumberFormat)
+}
+
+func validateTextTable(config Config) error {
+	if config.StatsFormat != "table" && config.StatsFormat != "text_table" {
+		return fmt.Errorf("unknown stats_format %q", config.StatsFormat)
+	}
+	if config.StatsFormat != "text_table" {
+		return nil
+	}
+	if config.CollectMode != "web" {
+		return errors.New("stats_format text_table only works with collect_mode web")
+	}
+	if _, err := cascadia.Compile(config.TextSelector); err != nil {
+		return fmt.Errorf("invalid text_selector %q: %w", config.TextSelector, err)
+	}
+	pattern, err := regexp.Compile(config.TextPortPattern)
+	if err != nil {
+		return fmt.Errorf("invalid text_port_pattern: %w", err)
+	}
+	if pattern.SubexpIndex("port") < 0 {
+		return errors.New("text_port_pattern needs a (?P<port>...) group")
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// portSample is the byte counters of a port at the time they were fetched.
+type portSample struct {
+	RxBytes uint64
+	TxBytes uint64
+	At      time.Time
+}
+
+// portUtilization is the share of the link speed used in each direction
+// between the last two samples.
+type portUtilization struct {
+	Rx float64
+	Tx float64
+}
+
+// updateUtilization derives per-port utilization from the byte deltas since
+// the previous fetch. Ports seen for the first time, ports whose counters
+// went backwards and ports without a known link speed get no value. With
+// utilization_ema_alpha, each value is also folded into its moving average,
+// which such ports start over.
+func (c *PortStatsCollector) updateUtilization(stats PortStatistics, now time.Time) {
+	previous := c.samples
+	previousEMA := c.utilizationEMA
+	c.samples = make(map[string]portSample, len(stats.Ports))
+	c.utilization = make(map[string]portUtilization, len(stats.Ports))
+	c.utilizationEMA = make(map[string]portUtilization, len(stats.Ports))
+
+	for _, port := range stats.Ports {
+		sample := portSample{RxBytes: port.RxGoodBytes, TxBytes: port.TxGoodBytes, At: now}
+		c.samples[port.Name] = sample
+
+		prev, ok := previous[port.Name]
+		if !ok || sample.RxBytes < prev.RxBytes || sample.TxBytes < prev.TxBytes {
+			continue
+		}
+		seconds := sample.At.Sub(prev.At).Seconds()
+		speed, ok := c.linkSpeedMbps(port.Name)
+		if seconds <= 0 || !ok || speed <= 0 {
+			continue
+		}
+
+		bitsPerSecond := speed * 1e6
+		u := portUtilization{
+			Rx: float64(sample.RxBytes-prev.RxBytes) * 8 / seconds / bitsPerSecond,
+			Tx: float64(sample.TxBytes-prev.TxBytes) * 8 / seconds / bitsPerSecond,
+		}
+		c.utilization[port.Name] = u
+
+		if alpha := c.config.UtilizationEMAAlpha; alpha > 0 {
+			ema := u
+			if prev, ok := previousEMA[port.Name]; ok {
+				ema.Rx = alpha*u.Rx + (1-alpha)*prev.Rx
+				ema.Tx = alpha*u.Tx + (1-alpha)*prev.Tx
+			}
+			c.utilizationEMA[port.Name] = ema
+		}
+
+		if threshold := c.config.SaturationThreshold; threshold > 0 && max(u.Rx, u.Tx) > threshold {
+			if c.saturationEvents == nil {
+				c.saturationEvents = make(map[string]float64)
+			}
+			c.saturationEvents[port.Name]++
+		}
+	}
+}
+
+// linkSpeedMbps returns the configured speed of the port, falling back to
+// the negotiated speed from the port settings page.
+func (c *PortStatsCollector) linkSpeedMbps(name string) (float64, bool) {
+	if speed, ok := c.config.PortLinkSpeeds[name]; ok {
+		return speed, true
+	}
+	if speed, ok := c.portSpeeds[name]; ok && speed.HasLink {
+		return speed.Link, true
+	}
+	return 0, false
+}
+
+func (c *PortStatsCollector) collectUtilization(ch chan<- prometheus.Metric, name string, labels []string) {
+	if c.config.SaturationThreshold > 0 {
+		ch <- c.constMetric(
+			c.portSaturation, prometheus.CounterValue,
+			c.saturationEvents[name], labels...,
+		)
+	}
+
+	u, ok := c.utilization[name]
+	if !ok {
+		return
+	}
+	ch <- c.constMetric(
+		c.portUtilization, prometheus.GaugeValue,
+		u.Rx, append(labels, "rx")...,
+	)
+	ch <- c.constMetric(
+		c.portUtilization, prometheus.GaugeValue,
+		u.Tx, append(labels, "tx")...,
+	)
+
+	ema, ok := c.utilizationEMA[name]
+	if !ok {
+		return
+	}
+	ch <- c.constMetric(
+		c.portUtilizationEMA, prometheus.GaugeValue,
+		ema.Rx, append(labels, "rx")...,
+	)
+	ch <- c.constMetric(
+		c.portUtilizationEMA, prometheus.GaugeValue,
+		ema.Tx, append(labels, "tx")...,
+	)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// byteCounters is a fetch of Port 1 with the given byte counters.
+func byteCounters(rx, tx uint64) PortStatistics {
+	return PortStatistics{Ports: []Port{{Name: "Port 1", RxGoodBytes: rx, TxGoodBytes: tx}}}
+}
+
+func newUtilizationCollector(t *testing.T, edit func(*Config)) *PortStatsCollector {
+	return NewPortStatsCollector(testConfig(t, "192.168.1.1", func(c *Config) {
+		// 1000 Mbps moves 1.25e9 bytes in 10 seconds
+		c.PortLinkSpeeds = map[string]float64{"Port 1": 1000}
+		if edit != nil {
+			edit(c)
+		}
+	}), prometheus.NewRegistry())
+}
+
+func TestUpdateUtilization(t *testing.T) {
+	c := newUtilizationCollector(t, nil)
+	start := time.Unix(1700000000, 0)
+
+	c.updateUtilization(byteCounters(1000, 1000), start)
+	if _, ok := c.utilization["Port 1"]; ok {
+		t.Error("utilization from the first sample")
+	}
+
+	c.updateUtilization(byteCounters(1000+625e6, 1000+125e6), start.Add(10*time.Second))
+	u, ok := c.utilization["Port 1"]
+	if !ok {
+		t.Fatal("no utilization from the second sample")
+	}
+	if math.Abs(u.Rx-0.5) > 1e-9 || math.Abs(u.Tx-0.1) > 1e-9 {
+		t.Errorf("got utilization %+v, want rx 0.5 and tx 0.1", u)
+	}
+
+	c.updateUtilization(byteCounters(10, 1000+250e6), start.Add(20*time.Second))
+	if u, ok := c.utilization["Port 1"]; ok {
+		t.Errorf("got utilization %+v across a counter reset", u)
+	}
+	c.updateUtilization(byteCounters(10+1.25e9, 1000+250e6), start.Add(30*time.Second))
+	if u := c.utilization["Port 1"]; math.Abs(u.Rx-1) > 1e-9 || u.Tx != 0 {
+		t.Errorf("got utilization %+v after a reset, want rx 1 and tx 0", u)
+	}
+
+	c.updateUtilization(PortStatistics{Ports: []Port{{Name: "Port 2", RxGoodBytes: 1e9}}}, start.Add(40*time.Second))
+	c.updateUtilization(PortStatistics{Ports: []Port{{Name: "Port 2", RxGoodBytes: 2e9}}}, start.Add(50*time.Second))
+	if _, ok := c.utilization["Port 2"]; ok {
+		t.Error("utilization for a port without a link speed")
+	}
+}
+
+func TestSaturationEvents(t *testing.T) {
+	c := newUtilizationCollector(t, func(c *Config) { c.SaturationThreshold = 0.9 })
+	start := time.Unix(1700000000, 0)
+
+	// Utilization of 0.5, 0.95, 1, 0.9 and 0.91 in rx, then 0.99 in tx
+	var rx, tx uint64
+	steps := []struct{ rx, tx uint64 }{
+		{0, 0}, {625e6, 0}, {1.1875e9, 0}, {1.25e9, 0}, {1.125e9, 0}, {1.1375e9, 0}, {0, 1.2375e9},
+	}
+	for i, step := range steps {
+		rx += step.rx
+		tx += step.tx
+		c.updateUtilization(byteCounters(rx, tx), start.Add(time.Duration(i)*10*time.Second))
+	}
+	if got := c.saturationEvents["Port 1"]; got != 4 {
+		t.Errorf("got %v saturation events, want 4", got)
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(c)
+	c.SetFetcher(&fakeFetcher{stats: byteCounters(rx, tx)})
+	c.lastStats, c.lastSuccess = byteCounters(rx, tx), time.Now()
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() == "port_saturation_events_total" {
+			if v := family.Metric[0].GetCounter().GetValue(); v != 4 {
+				t.Errorf("got port_saturation_events_total %v, want 4", v)
+			}
+			return
+		}
+	}
+	t.Error("no port_saturation_events_total")
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// VLANMembership is one port's membership in a VLAN. Mode is "tagged",
+// "untagged", or "member" when the firmware does not tell them apart.
+type VLANMembership struct {
+	VLAN string
+	Port string
+	Mode string
+}
+
+// portListPattern matches a port number or range such as 3 or 1-8 within
+// a list like "1-4,6" or "Port 1, Port 2".
+var portListPattern = regexp.MustCompile(`(\d+)(?:\s*-\s*(\d+))?`)
+
+// maxPortRange bounds a single range in a port list, so a misparsed cell
+// cannot produce an unbounded number of series.
+const maxPortRange = 128
+
+func (c *PortStatsCollector) refreshVLANs(ctx context.Context) {
+	// Without port names the page would resolve to "Port N" until the next
+	// refresh; try again with the next scrape
+	if len(c.lastStats.Ports) == 0 {
+		delete(c.familyFetchedAt, "vlan")
+		return
+	}
+	doc, err := fetchDocument(ctx, c.config, c.config.VLANPath)
+	if err != nil {
+		c.scrapeErrorsTotal.Inc()
+		log.Printf("Error fetching VLAN membership: %v", err)
+		return
+	}
+	vlans := parseVLANs(doc, c.portNamesByNumber())
+	for i := range vlans {
+		vlans[i].Port = c.truncateLabel(vlans[i].Port)
+	}
+	c.vlans = vlans
+}
+
+// portNamesByNumber maps the trailing number of each known port name to
+// the name, e.g. 3 to "Port 3", for resolving the port lists of the VLAN
+// page.
+func (c *PortStatsCollector) portNamesByNumber() map[int]string {
+	names := make(map[int]string, len(c.lastStats.Ports))
+	for _, port := range c.lastStats.Ports {
+		digits := strings.TrimLeft(port.Name, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ /-_")
+		if n, err := strconv.Atoi(digits); err == nil {
+			names[n] = port.Name
+		}
+	}
+	return names
+}
+
+func (c *PortStatsCollector) collectVLANs(ch chan<- prometheus.Metric) {
+	seen := map[VLANMembership]bool{}
+	for _, m := range c.vlans {
+		if seen[m] {
+			continue
+		}
+		seen[m] = true
+		ch <- c.constMetric(
+			c.portVLANMembership, prometheus.GaugeValue, 1,
+			m.Port, c.portRole(m.Port), m.VLAN, m.Mode,
+		)
+	}
+}
+
+// parseVLANs reads a table with one row per VLAN. The columns are found by
+// their headers: the first containing "vlan" or "id" holds the VLAN ID,
+// "untagged" and "tagged" the port lists by membership type and "member"
+// the ports of firmware that does not distinguish them. Port numbers are
+// resolved to names through names, falling back to "Port N".
+func parseVLANs(doc *goquery.Document, names map[int]string) []VLANMembership {
+	var memberships []VLANMembership
+	idCol := -1
+	modeCols := map[int]string{}
+
+	doc.Find("table tr").Each(func(i int, s *goquery.Selection) {
+		if headers := s.Find("th"); headers.Length() > 0 {
+			headers.Each(func(j int, th *goquery.Selection) {
+				text := strings.ToLower(th.Text())
+				switch {
+				case strings.Contains(text, "untagged"):
+					modeCols[j] = "untagged"
+				case strings.Contains(text, "tagged"):
+					modeCols[j] = "tagged"
+				case strings.Contains(text, "member"):
+					modeCols[j] = "member"
+				case (strings.Contains(text, "vlan") || strings.Contains(text, "id")) && idCol < 0:
+					idCol = j
+				}
+			})
+			return
+		}
+		if idCol < 0 {
+			return
+		}
+
+		cells := s.Find("td")
+		vlan := strings.TrimSpace(cells.Eq(idCol).Text())
+		if _, err := strconv.Atoi(vlan); err != nil {
+			return
+		}
+		for col, mode := range modeCols {
+			for _, n := range parsePortList(cells.Eq(col).Text()) {
+				name, ok := names[n]
+				if !ok {
+					name = "Port " + strconv.Itoa(n)
+				}
+				memberships = append(memberships, VLANMembership{VLAN: vlan, Port: name, Mode: mode})
+			}
+		}
+	})
+
+	return memberships
+}
+
+// parsePortList expands a list of port numbers and ranges.
+func parsePortList(text string) []int {
+	var ports []int
+	for _, match := range portListPattern.FindAllStringSubmatch(text, -1) {
+		first, _ := strconv.Atoi(match[1])
+		last := first
+		if match[2] != "" {
+			last, _ = strconv.Atoi(match[2])
+		}
+		if last < first || last-first >= maxPortRange {
+			continue
+		}
+		for n := first; n <= last; n++ {
+			ports = append(ports, n)
+		}
+	}
+	return ports
+}
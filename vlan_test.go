@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVLANPortNames(t *testing.T) {
+	sw := newFakeSwitch(t, map[string]string{
+		"/vlan.cgi": "<table><tr><th>VLAN ID</th><th>Untagged Ports</th></tr>" +
+			"<tr><td>10</td><td>1-2</td></tr></table>",
+	})
+	router, _ := newTestRouter(testConfig(t, sw.Address(), func(c *Config) {
+		c.CollectVLAN = true
+	}))
+
+	// The port names are not known before the first fetch of the stats
+	get(t, router, "/metrics")
+	sw.SetPage("/port.cgi?page=stats", strings.ReplaceAll(readFixture(t, "stats.html"), "Port ", "GE"))
+	_, body := get(t, router, "/metrics")
+	assertContains(t, body,
+		`port_vlan_membership{mode="untagged",port="GE1",role="unknown",vlan="10"} 1`,
+		`port_vlan_membership{mode="untagged",port="GE2",role="unknown",vlan="10"} 1`,
+	)
+	assertNotContains(t, body, `port="Port 1"`)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// portTransition is the JSON body posted to the webhook when a port goes
+// down or gets disabled.
+type portTransition struct {
+	Switch    string    `json:"switch"`
+	Port      string    `json:"port"`
+	Field     string    `json:"field"` // "state" or "link_status"
+	Old       string    `json:"old"`
+	New       string    `json:"new"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// WebhookPublisher posts a portTransition whenever a port changes from a
+// non-zero to a zero link status or state value between fetches. A port
+// notifies at most once per minInterval, so a flapping link does not flood
+// the receiver. Requests are sent on a background goroutine.
+type WebhookPublisher struct {
+	url              string
+	switchName       string
+	minInterval      time.Duration
+	stateValues      map[string]float64
+	linkStatusValues map[string]float64
+	client           *http.Client
+	queue            chan portTransition
+	errors           prometheus.Counter
+
+	previous   map[string]Port
+	notifiedAt map[string]time.Time
+}
+
+func NewWebhookPublisher(config Config, reg prometheus.Registerer) *WebhookPublisher {
+	p := &WebhookPublisher{
+		url:              config.WebhookURL,
+		switchName:       config.Address,
+		minInterval:      time.Duration(config.WebhookMinInterval) * time.Second,
+		stateValues:      mergeValues(DefaultStateValues, config.StateValues),
+		linkStatusValues: mergeValues(DefaultLinkStatusValues, config.LinkStatusValues),
+		client:           &http.Client{Timeout: time.Duration(config.Timeout) * time.Second},
+		queue:            make(chan portTransition, 64),
+		errors: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "exporter_webhook_errors_total",
+			Help: "Number of port transition notifications that could not be delivered",
+		}),
+		previous:   make(map[string]Port),
+		notifiedAt: make(map[string]time.Time),
+	}
+	go p.run()
+	return p
+}
+
+func (p *WebhookPublisher) Publish(stats PortStatistics) {
+	now := time.Now()
+	current := make(map[string]Port, len(stats.Ports))
+	for _, port := range stats.Ports {
+		current[port.Name] = port
+		prev, ok := p.previous[port.Name]
+		if !ok {
+			continue
+		}
+
+		if p.linkStatusValues[prev.LinkStatus] != 0 && p.linkStatusValues[port.LinkStatus] == 0 {
+			p.notify(portTransition{p.switchName, port.Name, "link_status", prev.LinkStatus, port.LinkStatus, now})
+		}
+		if p.stateValues[prev.State] != 0 && p.stateValues[port.State] == 0 {
+			p.notify(portTransition{p.switchName, port.Name, "state", prev.State, port.State, now})
+		}
+	}
+	p.previous = current
+}
+
+func (p *WebhookPublisher) notify(t portTransition) {
+	if t.Timestamp.Sub(p.notifiedAt[t.Port]) < p.minInterval {
+		debugf("Not notifying %s of %s on %s within %s of the last notification", t.Field, t.New, t.Port, p.minInterval)
+		return
+	}
+	p.notifiedAt[t.Port] = t.Timestamp
+
+	select {
+	case p.queue <- t:
+	default:
+		p.errors.Inc()
+		log.Printf("Webhook queue full, dropping notification for %s", t.Port)
+	}
+}
+
+func (p *WebhookPublisher) run() {
+	for t := range p.queue {
+		if err := p.send(t); err != nil {
+			p.errors.Inc()
+			log.Printf("Error sending webhook for %s: %v", t.Port, err)
+		}
+	}
+}
+
+func (p *WebhookPublisher) send(t portTransition) error {
+	body, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Post(p.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}